@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+)
+
+// printConfig prints the effective configuration (config file and environment variables) with masked secrets
+// usage: info config [--config config.json]
+// returns the exit code: 0 for a valid configuration, 1 for an invalid configuration, 2 on invalid usage
+func printConfig(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	configLocation := flags.String("config", "config.json", "configuration file")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	//configuration.Load prints used environment variables to os.Stdout, which is reserved for the result
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	_, err = os.Stat(*configLocation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	//the report is printed for invalid configurations too, to show the source of invalid values
+	config, libConfig, err := pkg.LoadConfig(*configLocation)
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	encodeErr := encoder.Encode(pkg.GetConfigReport(config, libConfig))
+	if encodeErr != nil {
+		fmt.Fprintln(os.Stderr, encodeErr)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
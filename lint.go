@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+)
+
+// lint checks the info tasks of bpmn files and prints the findings as json list
+// usage: info lint [--config config.json] [--topic info] process.bpmn...
+// returns the exit code: 0 without errors, 1 if an error has been found, 2 on invalid usage or unreadable files
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configLocation := flags.String("config", "config.json", "configuration file")
+	topic := flags.String("topic", "", "camunda topic of the info tasks (default the topics of all profiles)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: info lint [--config config.json] [--topic info] process.bpmn...")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	//the lib logger writes to os.Stdout, which is reserved for the result
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	config, libConfig, err := pkg.LoadConfig(*configLocation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	profiles := pkg.GetProfiles(config, libConfig)
+	if *topic != "" {
+		profile, err := pkg.GetProfile(config, libConfig, *topic)
+		if err != nil {
+			//unknown topics are checked with the parameters of the first profile
+			profile = profiles[0]
+			profile.CamundaWorkerTopic = *topic
+		}
+		profiles = []pkg.Profile{profile}
+	}
+
+	findings := []pkg.LintFinding{}
+	for _, file := range flags.Args() {
+		bpmn, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, profile := range profiles {
+			profileConfig, _ := profile.Apply(config, libConfig)
+			fileFindings, err := pkg.LintBpmn(profileConfig, profile.CamundaWorkerTopic, file, bpmn)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+			findings = append(findings, fileFindings...)
+		}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	err = encoder.Encode(findings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, finding := range findings {
+		if finding.Severity == pkg.LintSeverityError {
+			return 1
+		}
+	}
+	return 0
+}
@@ -20,7 +20,6 @@ import (
 	"context"
 	"flag"
 	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
-	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
 	"log"
 	"os"
 	"os/signal"
@@ -29,27 +28,47 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(render(os.Args[2:]))
+		case "lint":
+			os.Exit(lint(os.Args[2:]))
+		case "split":
+			os.Exit(split(os.Args[2:]))
+		case "config":
+			os.Exit(printConfig(os.Args[2:]))
+		}
+	}
+
 	configLocation := flag.String("config", "config.json", "configuration file")
 	flag.Parse()
 
-	libConfig, err := configuration.LoadLibConfig(*configLocation)
-	if err != nil {
-		log.Fatal(err)
-	}
-	config, err := configuration.Load[pkg.Config](*configLocation)
+	config, libConfig, err := pkg.LoadConfig(*configLocation)
 	if err != nil {
 		log.Fatal(err)
 	}
+	libConfig.GetLogger().Info("effective configuration", "config", pkg.GetConfigReport(config, libConfig))
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	wg := &sync.WaitGroup{}
 
-	err = pkg.Start(ctx, wg, config, libConfig)
+	reloader := pkg.NewReloader(*configLocation)
+	err = pkg.Start(ctx, wg, config, libConfig, pkg.WithReloader(reloader))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	go func() {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		for sig := range reload {
+			log.Println("received reload signal", sig)
+			_, _ = reloader.Reload() //errors are logged by Reload
+		}
+	}()
+
 	go func() {
 		shutdown := make(chan os.Signal, 1)
 		signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/julienschmidt/httprouter"
+)
+
+// StartApi serves the given endpoints on config.ApiAddress until ctx is done; an empty address disables the api
+func StartApi(ctx context.Context, wg *sync.WaitGroup, config Config, libConfig configuration.Config, endpoints ...func(router *httprouter.Router)) error {
+	return startApiServer(ctx, wg, "api", config.ApiAddress, libConfig, endpoints...)
+}
+
+// StartAdminApi serves the given endpoints on config.AdminApiAddress until ctx is done; an empty address disables the admin api
+// the admin api serves endpoints that read or write modules of all users with the token of the worker,
+// so it is kept apart from the probes and metrics of the api
+func StartAdminApi(ctx context.Context, wg *sync.WaitGroup, config Config, libConfig configuration.Config, endpoints ...func(router *httprouter.Router)) error {
+	return startApiServer(ctx, wg, "admin api", config.AdminApiAddress, libConfig, endpoints...)
+}
+
+func startApiServer(ctx context.Context, wg *sync.WaitGroup, name string, address string, libConfig configuration.Config, endpoints ...func(router *httprouter.Router)) error {
+	if address == "" || address == "-" {
+		return nil
+	}
+	router := httprouter.New()
+	for _, endpoint := range endpoints {
+		endpoint(router)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		libConfig.GetLogger().Info("start "+name, "address", listener.Addr().String())
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			libConfig.GetLogger().Error(name+" server stopped unexpectedly", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			libConfig.GetLogger().Error("unable to shutdown "+name+" server", "error", err)
+		}
+	}()
+	return nil
+}
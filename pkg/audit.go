@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// AuditEntry records who caused a module to be written or deleted
+type AuditEntry struct {
+	Time              time.Time `json:"time"`
+	ProcessInstanceId string    `json:"process_instance_id"`
+	TaskId            string    `json:"task_id"`
+	UserId            string    `json:"user_id"`
+	ModuleId          string    `json:"module_id"`
+	Keys              []string  `json:"keys"`
+	ModuleType        string    `json:"module_type"`
+	Action            string    `json:"action"` //type of the module event
+	Hash              string    `json:"hash"`   //sha256 of the module as stored in the smart service repository
+}
+
+// AuditSink is an append only log of audit entries
+type AuditSink interface {
+	Write(entry AuditEntry) error
+}
+
+// FileAuditSink appends audit entries as json lines to a file
+type FileAuditSink struct {
+	file *os.File
+	mux  sync.Mutex
+}
+
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+func (this *FileAuditSink) Write(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	_, err = this.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return this.file.Sync()
+}
+
+func (this *FileAuditSink) Close() error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.file.Close()
+}
+
+func (this *SmartServiceRepository) audit(modules []model.Module, events []ModuleEvent) {
+	if this.auditSink == nil {
+		return
+	}
+	eventsByModule := map[string]ModuleEvent{}
+	for _, event := range events {
+		eventsByModule[event.ModuleId] = event
+	}
+	for _, module := range modules {
+		event := eventsByModule[module.Id]
+		hash, err := getModuleVersion(module.SmartServiceModuleInit)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to hash module for audit log", "error", err, "moduleId", module.Id)
+		}
+		err = this.auditSink.Write(AuditEntry{
+			Time:              event.Time,
+			ProcessInstanceId: module.ProcesInstanceId,
+			TaskId:            event.TaskId,
+			UserId:            event.UserId,
+			ModuleId:          module.Id,
+			Keys:              module.Keys,
+			ModuleType:        module.ModuleType,
+			Action:            event.Type,
+			Hash:              hash,
+		})
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to write audit entry", "error", err, "moduleId", module.Id)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/camunda"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const camundaFetchPath = "/engine-rest/external-task/fetchAndLock"
+
+// Camunda runs the fetch loop of the lib (camunda.Camunda) with itself as handler and smart service repository of the loop
+// the handler may be replaced on reload; the modules of a task are written with the write plan of its Info (see Info.writeModules);
+// each task is traced from Do until its modules are written or its error is sent
+// the lib loop reports nothing about its state, so it is observed from outside: it is started with its own WaitGroup,
+// to report a stopped loop, and it reaches camunda through a loopback proxy, which reports the results of the fetch requests to Health
+// the lib loop handles one task at a time, so the state of the task in progress is kept in Camunda
+type Camunda struct {
+	libConfig        configuration.Config
+	handlerMux       sync.Mutex
+	handler          camundaHandler
+	smartServiceRepo *SmartServiceRepository
+	health           *Health
+	tracing          *Tracing
+	task             camundaHandler   //handler of the task in progress
+	taskHandler      camunda.Handler  //handler created for the task in progress
+	ctx              context.Context  //context of the task in progress, carrying its span
+	plan             *moduleWritePlan //write plan of the task in progress
+	endTask          func(err error)  //ends the span of the task in progress
+}
+
+// NewHandler creates the (middleware) handler of info for the context of a task
+type NewHandler func(ctx context.Context) camunda.Handler
+
+type camundaHandler struct {
+	newHandler NewHandler
+	info       *Info
+}
+
+// health and tracing may be nil
+func NewCamunda(libConfig configuration.Config, smartServiceRepo *SmartServiceRepository, newHandler NewHandler, info *Info, health *Health, tracing *Tracing) *Camunda {
+	return &Camunda{
+		libConfig:        libConfig,
+		handler:          camundaHandler{newHandler: newHandler, info: info},
+		smartServiceRepo: smartServiceRepo,
+		health:           health,
+		tracing:          tracing,
+	}
+}
+
+// SetHandler replaces the handler for the following tasks; running tasks are finished with the previous handler
+func (this *Camunda) SetHandler(newHandler NewHandler, info *Info) {
+	this.handlerMux.Lock()
+	defer this.handlerMux.Unlock()
+	this.handler = camundaHandler{newHandler: newHandler, info: info}
+}
+
+func (this *Camunda) getHandler() camundaHandler {
+	this.handlerMux.Lock()
+	defer this.handlerMux.Unlock()
+	return this.handler
+}
+
+func (this *Camunda) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	proxyUrl, stopProxy, err := startCamundaFetchObserver(this.libConfig, func(err error) {
+		this.health.fetched(this.libConfig.CamundaWorkerTopic, err)
+	})
+	if err != nil {
+		return err
+	}
+	libConfig := this.libConfig
+	libConfig.CamundaUrl = proxyUrl
+	loop := &sync.WaitGroup{}
+	this.health.loopStarted(this.libConfig.CamundaWorkerTopic)
+	camunda.New(libConfig, this, this).Start(ctx, loop)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		loop.Wait()
+		this.health.loopStopped(this.libConfig.CamundaWorkerTopic)
+		stopProxy()
+	}()
+	return nil
+}
+
+// Do implements camunda.Handler for the lib loop
+func (this *Camunda) Do(task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
+	this.ctx, _, this.endTask = this.tracing.startTask(context.Background(), "Camunda.executeTask", task)
+	this.task = this.getHandler()
+	this.taskHandler = this.task.newHandler(this.ctx)
+	modules, outputs, err = this.taskHandler.Do(task)
+	//taken even if the middleware fails after Info.Do (e.g. in a post-script), so that no plan is left behind
+	this.plan = this.task.info.takeWritePlan(task.Id)
+	return modules, outputs, err
+}
+
+// Undo implements camunda.Handler for the lib loop
+func (this *Camunda) Undo(modules []model.Module, reason error) {
+	this.taskHandler.Undo(modules, reason)
+}
+
+// SendWorkerError implements camunda.SmartServiceRepository for the lib loop
+func (this *Camunda) SendWorkerError(task model.CamundaExternalTask, err error) error {
+	defer this.taskDone(err)
+	return this.smartServiceRepo.WithContext(this.ctx).SendWorkerError(task, err)
+}
+
+// SendWorkerModules implements camunda.SmartServiceRepository for the lib loop
+func (this *Camunda) SendWorkerModules(modules []model.Module) (result []model.SmartServiceModule, err error) {
+	defer func() { this.taskDone(err) }()
+	plan := this.plan
+	this.plan = nil
+	return this.task.info.writeModules(this.ctx, this.smartServiceRepo.WithContext(this.ctx), modules, plan)
+}
+
+func (this *Camunda) taskDone(err error) {
+	if this.endTask != nil {
+		this.endTask(err)
+		this.endTask = nil
+	}
+}
+
+// starts a reverse proxy to libConfig.CamundaUrl on a loopback address, which calls onFetch with the result of each fetch request
+func startCamundaFetchObserver(libConfig configuration.Config, onFetch func(err error)) (proxyUrl string, stop func(), err error) {
+	target, err := url.Parse(libConfig.CamundaUrl)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid camunda url: %w", err)
+	}
+	isFetch := func(request *http.Request) bool {
+		return strings.HasSuffix(request.URL.Path, camundaFetchPath)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = func(response *http.Response) error {
+		if isFetch(response.Request) {
+			if response.StatusCode == http.StatusOK {
+				onFetch(nil)
+			} else {
+				onFetch(fmt.Errorf("%v %v", target.JoinPath(camundaFetchPath).String(), response.Status))
+			}
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+		if isFetch(request) {
+			onFetch(err)
+		}
+		libConfig.GetLogger().Error("unable to reach camunda", "error", err)
+		writer.WriteHeader(http.StatusBadGateway)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: proxy, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			libConfig.GetLogger().Error("camunda proxy stopped", "error", err)
+		}
+	}()
+	return "http://" + listener.Addr().String(), func() { _ = server.Close() }, nil
+}
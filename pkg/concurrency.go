@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrConcurrentModification = errors.New("concurrent modification")
+
+// returns a content hash of the module as it is returned by the smart service repository (e.g. numbers as float64),
+// so that written modules and the modules read from the repository have the same hash
+func getModuleVersion(init model.SmartServiceModuleInit) (string, error) {
+	temp, err := json.Marshal(init)
+	if err != nil {
+		return "", err
+	}
+	normalized := model.SmartServiceModuleInit{}
+	err = json.Unmarshal(temp, &normalized)
+	if err != nil {
+		return "", err
+	}
+	temp, err = json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(temp)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// existing receives a copy of init, so that later changes of the module do not change the recorded state
+func recordExistingModule(existing map[string]model.SmartServiceModuleInit, id string, init model.SmartServiceModuleInit) error {
+	temp, err := json.Marshal(init)
+	if err != nil {
+		return err
+	}
+	result := model.SmartServiceModuleInit{}
+	err = json.Unmarshal(temp, &result)
+	if err != nil {
+		return err
+	}
+	existing[id] = result
+	return nil
+}
+
+func getModuleVersions(existing map[string]model.SmartServiceModuleInit) (versions map[string]string, err error) {
+	versions = map[string]string{}
+	for id, init := range existing {
+		versions[id], err = getModuleVersion(init)
+		if err != nil {
+			return versions, err
+		}
+	}
+	return versions, nil
+}
+
+// number of times the modules of a task are assembled again after a concurrent modification, before the task fails
+// and is retried by camunda after its lock duration
+const maxConcurrentModificationRetries = 3
+
+type ModuleWriter interface {
+	SendCheckedModules(modules []model.Module, deletes []model.Module, versions map[string]string, events []ModuleEvent) (result []model.SmartServiceModule, err error)
+}
+
+// writeModules writes the modules of a task and removes its deleted modules with the versions and events of its plan (see Info.Do)
+// if a module read by the task has been modified concurrently, the task is handled again with the current state of its modules
+// the outputs of the repeated handling are dropped; the task completes with the outputs of Do
+// without plan, the modules are written without check
+func (this *Info) writeModules(ctx context.Context, writer ModuleWriter, modules []model.Module, plan *moduleWritePlan) (result []model.SmartServiceModule, err error) {
+	if plan == nil {
+		return writer.SendCheckedModules(modules, nil, nil, nil)
+	}
+	for attempt := 1; ; attempt++ {
+		result, err = writer.SendCheckedModules(modules, plan.deletes, plan.versions, plan.events)
+		if !errors.Is(err, ErrConcurrentModification) || attempt > maxConcurrentModificationRetries {
+			return result, err
+		}
+		this.libConfig.GetLogger().Warn("handle task again after concurrent modification", "taskId", plan.task.Id, "attempt", attempt, "error", err)
+		modules, _, plan, err = this.handleTask(ctx, plan.task, plan.rawVariables)
+		if err != nil {
+			return result, err
+		}
+	}
+}
+
+// SendWorkerModules writes the modules without version check (see SendCheckedModules)
+func (this *SmartServiceRepository) SendWorkerModules(modules []model.Module) (result []model.SmartServiceModule, err error) {
+	return this.SendCheckedModules(modules, nil, nil, nil)
+}
+
+// SendCheckedModules writes the modules and then deletes the modules of deletes (see deleteStoredModule), if none of the modules
+// with an entry in versions has been changed since it was read, and handles the events by ModulesChanged after a successful write
+// deletes run after the write, so that a failed write leaves the modules to delete untouched and the task can be retried
+// the smart service repository has no conditional write: checked modules are read again after the write, and if another writer
+// has overwritten one of them in the meantime, ErrConcurrentModification is returned, so that the task is handled again (see Info.writeModules)
+// two writers whose checks both pass before either of them writes, and whose writes both pass the second check, may still lose an update
+func (this *SmartServiceRepository) SendCheckedModules(modules []model.Module, deletes []model.Module, versions map[string]string, events []ModuleEvent) (result []model.SmartServiceModule, err error) {
+	if len(versions) > 0 {
+		this.checkedWritesMux.Lock()
+		defer this.checkedWritesMux.Unlock()
+		for _, module := range slices.Concat(modules, deletes) {
+			expected, ok := versions[module.Id]
+			if !ok {
+				continue
+			}
+			err = this.checkModuleVersion(module, expected)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+	processInstanceId := ""
+	if len(modules) > 0 {
+		processInstanceId = modules[0].ProcesInstanceId
+	}
+	done := this.observe("send_modules", processInstanceId, attribute.Int("modules", len(modules)))
+	result, err = this.SmartServiceRepository.SendWorkerModules(modules)
+	done(err)
+	if err != nil {
+		return result, err
+	}
+	for _, module := range modules {
+		if _, ok := versions[module.Id]; !ok {
+			continue
+		}
+		err = this.checkWrittenModule(module)
+		if err != nil {
+			return result, err
+		}
+	}
+	for i, module := range deletes {
+		err = deleteStoredModule(this, this.libConfig, module)
+		if err != nil {
+			//the written modules and the already deleted modules are reported nevertheless
+			changed := slices.Concat(modules, deletes[:i])
+			this.ModulesChanged(changed, slices.DeleteFunc(slices.Clone(events), func(event ModuleEvent) bool {
+				return !slices.ContainsFunc(changed, func(module model.Module) bool { return module.Id == event.ModuleId })
+			}))
+			return result, err
+		}
+	}
+	this.ModulesChanged(slices.Concat(modules, deletes), events)
+	return result, nil
+}
+
+func (this *SmartServiceRepository) getCurrentModule(module model.Module) (current model.SmartServiceModule, err error) {
+	userId, err := this.GetInstanceUser(module.ProcesInstanceId)
+	if err != nil {
+		return current, err
+	}
+	current, err, code := this.GetModule(userId, module.Id)
+	if code == http.StatusNotFound {
+		this.libConfig.GetLogger().Warn("module has been removed concurrently", "moduleId", module.Id)
+		return current, fmt.Errorf("%w: module %v has been removed", ErrConcurrentModification, module.Id)
+	}
+	return current, err
+}
+
+func (this *SmartServiceRepository) checkModuleVersion(module model.Module, expected string) error {
+	current, err := this.getCurrentModule(module)
+	if err != nil {
+		return err
+	}
+	version, err := getModuleVersion(current.SmartServiceModuleInit)
+	if err != nil {
+		return err
+	}
+	if version != expected {
+		this.libConfig.GetLogger().Warn("module has been modified concurrently", "moduleId", module.Id, "expected", expected, "current", version)
+		return fmt.Errorf("%w: module %v has been modified", ErrConcurrentModification, module.Id)
+	}
+	return nil
+}
+
+// checks that the written module has not been overwritten by another writer, whose check passed at the same time
+func (this *SmartServiceRepository) checkWrittenModule(module model.Module) error {
+	current, err := this.getCurrentModule(module)
+	if err != nil {
+		return err
+	}
+	same, err := isSameModuleContent(current.SmartServiceModuleInit, module.SmartServiceModuleInit)
+	if err != nil {
+		return err
+	}
+	if !same {
+		this.libConfig.GetLogger().Warn("module has been overwritten concurrently", "moduleId", module.Id)
+		return fmt.Errorf("%w: module %v has been overwritten", ErrConcurrentModification, module.Id)
+	}
+	return nil
+}
+
+// compares the stored module with the written module; the repository may return empty keys as null and numbers as float
+func isSameModuleContent(stored model.SmartServiceModuleInit, written model.SmartServiceModuleInit) (bool, error) {
+	if stored.ModuleType != written.ModuleType || !slices.Equal(stored.Keys, written.Keys) {
+		return false, nil
+	}
+	storedData, err := normalizeModuleData(stored.ModuleData)
+	if err != nil {
+		return false, err
+	}
+	writtenData, err := normalizeModuleData(written.ModuleData)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(storedData, writtenData), nil
+}
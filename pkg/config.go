@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+)
+
+// LoadConfig loads Config and the lib config from the json file at location and the environment variables overriding its fields
+// environment variables are named like the json fields in upper case (e.g. api_address --> API_ADDRESS)
+// unlike configuration.Load, invalid environment values and invalid configurations are reported as error
+func LoadConfig(location string) (config Config, libConfig configuration.Config, err error) {
+	envErr := errors.Join(checkEnvironmentVars[configuration.Config](), checkEnvironmentVars[Config]())
+	if errors.Is(envErr, ErrUnsupportedConfigEnvironmentVar) {
+		return config, libConfig, envErr //configuration.Load would panic
+	}
+	libConfig, err = configuration.LoadLibConfig(location)
+	if err != nil {
+		return config, libConfig, err
+	}
+	config, err = configuration.Load[Config](location)
+	if err != nil {
+		return config, libConfig, err
+	}
+	err = errors.Join(envErr, config.Validate())
+	return config, libConfig, err
+}
+
+// Validate checks the fields of the config, that are not checked while loading the json file
+func (this Config) Validate() error {
+	errs := []error{}
+	for name, value := range map[string]string{
+		"expired_module_sweep_interval":       this.ExpiredModuleSweepInterval,
+		"module_refresh_interval":             this.ModuleRefreshInterval,
+		"health_max_fetch_age":                this.HealthMaxFetchAge,
+		"shutdown_delay":                      this.ShutdownDelay,
+		"config_reload_interval":              this.ConfigReloadInterval,
+		"module_script_timeout":               this.ModuleScriptTimeout,
+		"module_data_template_cache_duration": this.ModuleDataTemplateCacheDuration,
+	} {
+		if value == "" || value == "-" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %v: %w", name, err))
+		} else if duration < 0 {
+			errs = append(errs, fmt.Errorf("invalid %v: negative duration", name))
+		}
+	}
+	switch this.ExpiredModuleAction {
+	case "", ExpiredModuleActionDelete, ExpiredModuleActionMark:
+	default:
+		errs = append(errs, fmt.Errorf("unknown expired_module_action: %v", this.ExpiredModuleAction))
+	}
+	switch this.TracingExporter {
+	case "", "-", TracingExporterStdout, TracingExporterOtlp:
+	default:
+		errs = append(errs, fmt.Errorf("unknown tracing_exporter: %v", this.TracingExporter))
+	}
+	if this.KafkaUrl != "" && this.KafkaUrl != "-" && this.ModuleEventTopic == "" {
+		errs = append(errs, errors.New("module_event_topic is required, if kafka_url is set"))
+	}
+	if this.AdminApiAddress != "" && this.AdminApiAddress != "-" && this.AdminApiAddress == this.ApiAddress {
+		errs = append(errs, errors.New("admin_api_address must differ from api_address"))
+	}
+	if this.EnablePreviewApi && (this.ApiAddress == "" || this.ApiAddress == "-") {
+		errs = append(errs, errors.New("enable_preview_api requires api_address"))
+	}
+	errs = append(errs, validateProfiles(this.Profiles)...)
+	if this.ModuleScriptProcessAllocLimitMb < 0 {
+		errs = append(errs, errors.New("invalid module_script_process_alloc_limit_mb: negative limit"))
+	}
+	errs = append(errs, validateModuleProcessors(this.ModuleProcessors)...)
+	for _, profile := range GetProfiles(this, configuration.Config{}) {
+		errs = append(errs, validateRedactedModuleDataFields(profile.RedactedModuleDataFields, this.ModuleProcessors)...)
+	}
+	if _, err := loadModuleScripts(this.ModuleScriptsDir); err != nil {
+		errs = append(errs, fmt.Errorf("invalid module_scripts_dir: %w", err))
+	}
+	if this.ModuleDataTemplatesDir != "" && this.ModuleDataTemplatesDir != "-" {
+		if info, err := os.Stat(this.ModuleDataTemplatesDir); err != nil {
+			errs = append(errs, fmt.Errorf("invalid module_data_templates_dir: %w", err))
+		} else if !info.IsDir() {
+			errs = append(errs, errors.New("invalid module_data_templates_dir: not a directory"))
+		}
+	}
+	if this.ModuleDataTemplatesUrl != "" && this.ModuleDataTemplatesUrl != "-" {
+		if u, err := url.Parse(this.ModuleDataTemplatesUrl); err != nil {
+			errs = append(errs, fmt.Errorf("invalid module_data_templates_url: %w", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("invalid module_data_templates_url: unsupported scheme %q", u.Scheme))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errors.Join(errs...)
+}
+
+// same naming scheme as used by configuration.Load
+var configFieldNamePattern = regexp.MustCompile("(^[^A-Z]*|[A-Z]*)([A-Z][^A-Z]+|$)")
+
+func getConfigEnvName(fieldName string) string {
+	var parts []string
+	for _, sub := range configFieldNamePattern.FindAllStringSubmatch(fieldName, -1) {
+		if sub[1] != "" {
+			parts = append(parts, sub[1])
+		}
+		if sub[2] != "" {
+			parts = append(parts, sub[2])
+		}
+	}
+	return strings.ToUpper(strings.Join(parts, "_"))
+}
+
+// environment variables for fields, that configuration.Load can not set (e.g. profiles), must not be used
+var ErrUnsupportedConfigEnvironmentVar = errors.New("unsupported environment variable")
+
+// configuration.Load ignores invalid values (e.g. ENABLE_PREVIEW_API=yes is used as false); checkEnvironmentVars reports them
+func checkEnvironmentVars[T any]() error {
+	errs := []error{}
+	configType := reflect.TypeFor[T]()
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		envName := getConfigEnvName(field.Name)
+		value := os.Getenv(envName)
+		if value == "" {
+			continue
+		}
+		var err error
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int64:
+			_, err = strconv.ParseInt(value, 10, 64)
+		case reflect.Bool:
+			_, err = strconv.ParseBool(value)
+		case reflect.Float64:
+			_, err = strconv.ParseFloat(value, 64)
+		case reflect.String:
+		case reflect.Slice:
+			if field.Type.Elem().Kind() != reflect.String {
+				err = fmt.Errorf("%w for field type %v", ErrUnsupportedConfigEnvironmentVar, field.Type)
+			}
+		default:
+			err = fmt.Errorf("%w for field type %v", ErrUnsupportedConfigEnvironmentVar, field.Type)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid environment variable %v: %w", envName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+const ConfigSourceFile = "file"
+const ConfigSourceEnv = "env"
+
+// ConfigReportEntry is a field of the effective configuration
+// values of fields tagged with `config:"secret"` are masked
+type ConfigReportEntry struct {
+	Name   string      `json:"name"`
+	Env    string      `json:"env"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+const maskedConfigValue = "***"
+
+// GetConfigReport lists the fields of the lib config and config, ordered by name
+func GetConfigReport(config Config, libConfig configuration.Config) []ConfigReportEntry {
+	report := append(getConfigReport(libConfig), getConfigReport(config)...)
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Name < report[j].Name
+	})
+	return report
+}
+
+func getConfigReport(config interface{}) (report []ConfigReportEntry) {
+	configValue := reflect.ValueOf(config)
+	configType := configValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		entry := ConfigReportEntry{
+			Name:   name,
+			Env:    getConfigEnvName(field.Name),
+			Value:  configValue.Field(i).Interface(),
+			Source: ConfigSourceFile,
+		}
+		if os.Getenv(entry.Env) != "" {
+			entry.Source = ConfigSourceEnv
+		}
+		if strings.Contains(field.Tag.Get("config"), "secret") && !configValue.Field(i).IsZero() {
+			entry.Value = maskedConfigValue
+		}
+		report = append(report, entry)
+	}
+	return report
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const ChangeAdd = "add"
+const ChangeRemove = "remove"
+const ChangeReplace = "replace"
+
+// ModuleDataChange describes one change of module_data; path is a JSON pointer (RFC 6901)
+type ModuleDataChange struct {
+	Op       string      `json:"op"`
+	Path     string      `json:"path"`
+	Value    interface{} `json:"value,omitempty"`
+	OldValue interface{} `json:"old_value,omitempty"`
+}
+
+// returns the changes needed to get from previous to current, ordered by path
+// arrays are compared by index; removed array elements are listed from the last to the first
+func getModuleDataChanges(previous map[string]interface{}, current map[string]interface{}) (result []ModuleDataChange, err error) {
+	current, err = normalizeModuleData(current)
+	if err != nil {
+		return nil, err
+	}
+	result = []ModuleDataChange{}
+	diffValues("", previous, current, &result)
+	return result, nil
+}
+
+func diffValues(path string, previous interface{}, current interface{}, result *[]ModuleDataChange) {
+	switch p := previous.(type) {
+	case map[string]interface{}:
+		if c, ok := current.(map[string]interface{}); ok {
+			diffObjects(path, p, c, result)
+			return
+		}
+	case []interface{}:
+		if c, ok := current.([]interface{}); ok {
+			diffArrays(path, p, c, result)
+			return
+		}
+	}
+	if !reflect.DeepEqual(previous, current) {
+		*result = append(*result, ModuleDataChange{Op: ChangeReplace, Path: path, Value: current, OldValue: previous})
+	}
+}
+
+func diffObjects(path string, previous map[string]interface{}, current map[string]interface{}, result *[]ModuleDataChange) {
+	keys := []string{}
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		subPath := path + "/" + escapeJsonPointer(key)
+		previousValue, inPrevious := previous[key]
+		currentValue, inCurrent := current[key]
+		switch {
+		case !inCurrent:
+			*result = append(*result, ModuleDataChange{Op: ChangeRemove, Path: subPath, OldValue: previousValue})
+		case !inPrevious:
+			*result = append(*result, ModuleDataChange{Op: ChangeAdd, Path: subPath, Value: currentValue})
+		default:
+			diffValues(subPath, previousValue, currentValue, result)
+		}
+	}
+}
+
+func diffArrays(path string, previous []interface{}, current []interface{}, result *[]ModuleDataChange) {
+	common := min(len(previous), len(current))
+	for i := 0; i < common; i++ {
+		diffValues(path+"/"+strconv.Itoa(i), previous[i], current[i], result)
+	}
+	for i := common; i < len(current); i++ {
+		*result = append(*result, ModuleDataChange{Op: ChangeAdd, Path: path + "/" + strconv.Itoa(i), Value: current[i]})
+	}
+	for i := len(previous) - 1; i >= common; i-- {
+		*result = append(*result, ModuleDataChange{Op: ChangeRemove, Path: path + "/" + strconv.Itoa(i), OldValue: previous[i]})
+	}
+}
+
+func escapeJsonPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// sets the output variable named by the diff_output variable to a json object mapping the ids of updated modules to their changes
+func (this *Info) setDiffOutput(task model.CamundaExternalTask, events []ModuleEvent, outputs map[string]interface{}) error {
+	name, err := this.getStringVariable(task, "diff_output")
+	if err != nil || name == "" {
+		return err
+	}
+	diff := map[string][]ModuleDataChange{}
+	for _, event := range events {
+		if event.Changes != nil {
+			diff[event.ModuleId] = event.Changes
+		}
+	}
+	temp, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	outputs[name] = string(temp)
+	return nil
+}
+
+func (this *Info) logModuleChanges(events []ModuleEvent) {
+	for _, event := range events {
+		if event.Type == ModuleUpdated {
+			this.libConfig.GetLogger().Info("module data changed", "moduleId", event.ModuleId, "keys", event.Keys, "changes", event.Changes)
+		}
+	}
+}
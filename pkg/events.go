@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const ModuleCreated = "module_created"
+const ModuleUpdated = "module_updated"
+const ModuleUnchanged = "module_unchanged"
+const ModuleDeleted = "module_deleted"
+const ModuleRestored = "module_restored"
+
+type ModuleEvent struct {
+	Type              string             `json:"type"`
+	ModuleId          string             `json:"module_id"`
+	Keys              []string           `json:"keys"`
+	ModuleType        string             `json:"module_type"`
+	ProcessInstanceId string             `json:"process_instance_id"`
+	TaskId            string             `json:"task_id"`
+	UserId            string             `json:"user_id"`
+	Time              time.Time          `json:"time"`
+	Diff              *ModuleDiffSummary `json:"diff,omitempty"`
+	Changes           []ModuleDataChange `json:"changes,omitempty"`
+}
+
+// top level module_data fields that have been added, removed or changed by an update
+type ModuleDiffSummary struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+func (this ModuleDiffSummary) IsEmpty() bool {
+	return len(this.Added) == 0 && len(this.Removed) == 0 && len(this.Changed) == 0
+}
+
+// ModuleEventProducer sends a message to the configured module event topic
+type ModuleEventProducer interface {
+	Produce(key string, message []byte) error
+}
+
+func newModuleEvent(eventType string, task model.CamundaExternalTask, module model.Module) ModuleEvent {
+	return ModuleEvent{
+		Type:              eventType,
+		ModuleId:          module.Id,
+		Keys:              module.Keys,
+		ModuleType:        module.ModuleType,
+		ProcessInstanceId: module.ProcesInstanceId,
+		TaskId:            task.Id,
+	}
+}
+
+// existing contains the stored state of the updated modules; all other modules are created
+func getModuleEvents(task model.CamundaExternalTask, modules []model.Module, existing map[string]model.SmartServiceModuleInit) (events []ModuleEvent, err error) {
+	for _, module := range modules {
+		previous, ok := existing[module.Id]
+		if !ok {
+			events = append(events, newModuleEvent(ModuleCreated, task, module))
+			continue
+		}
+		event, err := getModuleUpdateEvent(task, module, previous)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func getModuleUpdateEvent(task model.CamundaExternalTask, module model.Module, previous model.SmartServiceModuleInit) (event ModuleEvent, err error) {
+	diff, err := getModuleDiffSummary(previous.ModuleData, module.ModuleData)
+	if err != nil {
+		return event, err
+	}
+	changes, err := getModuleDataChanges(previous.ModuleData, module.ModuleData)
+	if err != nil {
+		return event, err
+	}
+	event = newModuleEvent(ModuleUpdated, task, module)
+	if diff.IsEmpty() && previous.ModuleType == module.ModuleType && slices.Equal(previous.Keys, module.Keys) {
+		event.Type = ModuleUnchanged
+	}
+	event.Diff = &diff
+	event.Changes = changes
+	return event, nil
+}
+
+func getModuleDiffSummary(previous map[string]interface{}, current map[string]interface{}) (result ModuleDiffSummary, err error) {
+	current, err = normalizeModuleData(current)
+	if err != nil {
+		return result, err
+	}
+	for key, value := range current {
+		previousValue, ok := previous[key]
+		if !ok {
+			result.Added = append(result.Added, key)
+		} else if !reflect.DeepEqual(previousValue, value) {
+			result.Changed = append(result.Changed, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			result.Removed = append(result.Removed, key)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+	return result, nil
+}
+
+// returns data as it would be returned by the smart service repository
+func normalizeModuleData(data map[string]interface{}) (result map[string]interface{}, err error) {
+	temp, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	result = map[string]interface{}{}
+	err = json.Unmarshal(temp, &result)
+	return result, err
+}
+
+// events that are published, when their module has been written
+// ModulesChanged records the revisions and audit entries of modules that have already been written or deleted and publishes their events
+// errors are logged; the modules are not rolled back
+func (this *SmartServiceRepository) ModulesChanged(modules []model.Module, events []ModuleEvent) {
+	for _, event := range events {
+		this.metrics.countModule(event.ModuleType, event.Type)
+	}
+	events = this.completeModuleEvents(events)
+	this.recordRevisions(modules, events)
+	this.audit(modules, events)
+	this.publishModuleEvents(events)
+}
+
+// sets the user and time of events, where they are missing (e.g. events of refreshed or restored modules)
+func (this *SmartServiceRepository) completeModuleEvents(events []ModuleEvent) (result []ModuleEvent) {
+	if this.producer == nil && this.auditSink == nil {
+		return events
+	}
+	now := time.Now()
+	for _, event := range events {
+		if event.UserId == "" {
+			userId, err := this.GetInstanceUser(event.ProcessInstanceId)
+			if err != nil {
+				this.libConfig.GetLogger().Error("unable to get user of module event", "error", err, "moduleId", event.ModuleId)
+			}
+			event.UserId = userId
+		}
+		if event.Time.IsZero() {
+			event.Time = now
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+func (this *SmartServiceRepository) publishModuleEvents(events []ModuleEvent) {
+	if this.producer == nil {
+		return
+	}
+	for _, event := range events {
+		message, err := json.Marshal(event)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to marshal module event", "error", err, "moduleId", event.ModuleId)
+			continue
+		}
+		err = this.producer.Produce(event.ModuleId, message)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to publish module event", "error", err, "moduleId", event.ModuleId, "type", event.Type)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SENERGY-Platform/service-commons/pkg/util"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const ExpiredModuleActionDelete = "delete"
+const ExpiredModuleActionMark = "mark"
+
+var ErrModuleExpired = errors.New("module expired")
+
+type SweeperRepo interface {
+	ListModules(query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	UseModuleDeleteInfo(info model.ModuleDeleteInfo) error
+	DeleteModule(processInstanceId string, moduleId string) error
+	SetSmartServiceModuleError(moduleId string, errMsg error) error
+	ModulesChanged(modules []model.Module, events []ModuleEvent)
+}
+
+// Sweeper removes or marks modules whose expires_at metadata lies in the past
+// only modules of the types the worker writes are swept (see SetModuleTypes); the module data is written by tasks,
+// so the process instance in its metadata is only used, if the repository lists the module for this process instance
+type Sweeper struct {
+	config      Config
+	libConfig   configuration.Config
+	repo        SweeperRepo
+	now         func() time.Time
+	moduleTypes atomic.Pointer[[]string]
+}
+
+func NewSweeper(config Config, libConfig configuration.Config, repo SweeperRepo, now func() time.Time) (*Sweeper, error) {
+	switch config.ExpiredModuleAction {
+	case "":
+		config.ExpiredModuleAction = ExpiredModuleActionDelete
+	case ExpiredModuleActionDelete, ExpiredModuleActionMark:
+	default:
+		return nil, fmt.Errorf("unknown expired_module_action: %v", config.ExpiredModuleAction)
+	}
+	if now == nil {
+		now = time.Now
+	}
+	result := &Sweeper{config: config, libConfig: libConfig, repo: repo, now: now}
+	result.SetModuleTypes(GetProfiles(config, libConfig))
+	return result, nil
+}
+
+// sets the swept module types to the module types of the profiles (see getProfileModuleTypes)
+func (this *Sweeper) SetModuleTypes(profiles []Profile) {
+	moduleTypes := getProfileModuleTypes(profiles)
+	this.moduleTypes.Store(&moduleTypes)
+}
+
+// runs Sweep every ExpiredModuleSweepInterval until ctx is done; an empty interval disables the sweeper
+func (this *Sweeper) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	if this.config.ExpiredModuleSweepInterval == "" || this.config.ExpiredModuleSweepInterval == "-" {
+		return nil
+	}
+	interval, err := time.ParseDuration(this.config.ExpiredModuleSweepInterval)
+	if err != nil {
+		return fmt.Errorf("invalid expired_module_sweep_interval: %w", err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid expired_module_sweep_interval: %v", interval)
+	}
+	ticker := time.NewTicker(interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := this.Sweep()
+				if err != nil {
+					this.libConfig.GetLogger().Error("unable to sweep expired modules", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// handles all modules that are expired at the time of the call
+func (this *Sweeper) Sweep() error {
+	expired, err := this.listExpiredModules()
+	if err != nil {
+		return err
+	}
+	handled := 0
+	for _, module := range expired {
+		err = this.handleExpiredModule(module)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to handle expired module", "error", err, "moduleId", module.Id)
+			continue
+		}
+		handled++
+	}
+	if len(expired) > 0 {
+		this.libConfig.GetLogger().Info("swept expired modules", "action", this.config.ExpiredModuleAction, "expired", len(expired), "handled", handled)
+	}
+	return nil
+}
+
+// collects all expired modules of the module types before any of them is changed, to keep the list offsets stable
+func (this *Sweeper) listExpiredModules() (result []model.SmartServiceModule, err error) {
+	now := this.now()
+	for _, moduleType := range *this.moduleTypes.Load() {
+		for module, err := range util.IterBatch(100, func(limit int64, offset int64) ([]model.SmartServiceModule, error) {
+			return this.repo.ListModules(model.ModulQuery{TypeFilter: &moduleType, Limit: limit, Offset: offset})
+		}) {
+			if err != nil {
+				return nil, err
+			}
+			if module.ModuleType != moduleType {
+				continue
+			}
+			meta, ok := getModuleMetadata(module.ModuleData)
+			if !ok || meta.ExpiresAt == nil || meta.ExpiresAt.After(now) {
+				continue
+			}
+			if this.config.ExpiredModuleAction == ExpiredModuleActionMark && module.Error != "" {
+				continue
+			}
+			result = append(result, module)
+		}
+	}
+	return result, nil
+}
+
+func (this *Sweeper) handleExpiredModule(module model.SmartServiceModule) error {
+	switch this.config.ExpiredModuleAction {
+	case ExpiredModuleActionMark:
+		return this.repo.SetSmartServiceModuleError(module.Id, ErrModuleExpired)
+	default:
+		meta, _ := getModuleMetadata(module.ModuleData)
+		if meta.ProcessInstanceId == "" {
+			return errors.New("missing process instance id of expired module")
+		}
+		owned, err := isProcessInstanceModule(this.repo, meta.ProcessInstanceId, module.Id, model.ModulQuery{TypeFilter: &module.ModuleType})
+		if err != nil {
+			return err
+		}
+		if !owned {
+			return fmt.Errorf("expired module %v does not belong to process instance %v of its metadata", module.Id, meta.ProcessInstanceId)
+		}
+		//deleted like modules of tasks: the delete info is used and the delete is reported as module event, revision and audit entry
+		deleted := model.Module{Id: module.Id, ProcesInstanceId: meta.ProcessInstanceId, SmartServiceModuleInit: module.SmartServiceModuleInit}
+		err = deleteStoredModule(this.repo, this.libConfig, deleted)
+		if err != nil {
+			return err
+		}
+		this.repo.ModulesChanged([]model.Module{deleted}, []ModuleEvent{newModuleEvent(ModuleDeleted, model.CamundaExternalTask{}, deleted)})
+		return nil
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+type HealthRepo interface {
+	ListModules(query model.ModulQuery) (result []model.SmartServiceModule, err error)
+}
+
+// Health tracks the state of the camunda fetch loop and checks the reachability of the smart service repository and the auth endpoint
+// a nil Health ignores all reports
+type Health struct {
+	libConfig     configuration.Config
+	repo          HealthRepo
+	auth          Auth
+	maxFetchAge   time.Duration
+	mux           sync.Mutex
+	loops         map[string]*healthLoop
+	shuttingDown  bool
+	checkTimeout  time.Duration
+	now           func() time.Time
+	dependencyMux sync.Mutex
+}
+
+// state of the fetch loop of a topic
+type healthLoop struct {
+	started     time.Time
+	running     bool
+	lastSuccess time.Time
+	lastError   string
+}
+
+type HealthStatus struct {
+	Status                 string     `json:"status"`
+	ShuttingDown           bool       `json:"shutting_down"`
+	CamundaLoopRunning     bool       `json:"camunda_loop_running"`
+	LastFetchSuccess       *time.Time `json:"last_fetch_success,omitempty"`
+	LastFetchError         string     `json:"last_fetch_error,omitempty"`
+	SmartServiceRepository string     `json:"smart_service_repository,omitempty"`
+	Auth                   string     `json:"auth,omitempty"`
+}
+
+const HealthStatusOk = "ok"
+const HealthStatusUnavailable = "unavailable"
+
+func NewHealth(config Config, libConfig configuration.Config, repo HealthRepo, auth Auth) (*Health, error) {
+	maxFetchAge := 5 * time.Minute
+	if config.HealthMaxFetchAge != "" {
+		var err error
+		maxFetchAge, err = time.ParseDuration(config.HealthMaxFetchAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health_max_fetch_age: %w", err)
+		}
+	}
+	return &Health{
+		libConfig:    libConfig,
+		repo:         repo,
+		auth:         auth,
+		maxFetchAge:  maxFetchAge,
+		loops:        map[string]*healthLoop{},
+		checkTimeout: 5 * time.Second,
+		now:          time.Now,
+	}, nil
+}
+
+func (this *Health) loopStarted(topic string) {
+	if this == nil {
+		return
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.loops[topic] = &healthLoop{running: true, started: this.now()}
+}
+
+func (this *Health) loopStopped(topic string) {
+	if this == nil {
+		return
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if loop, ok := this.loops[topic]; ok {
+		loop.running = false
+	}
+}
+
+func (this *Health) fetched(topic string, err error) {
+	if this == nil {
+		return
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	loop, ok := this.loops[topic]
+	if !ok {
+		return
+	}
+	if err != nil {
+		loop.lastError = err.Error()
+		return
+	}
+	loop.lastSuccess = this.now()
+	loop.lastError = ""
+}
+
+// ShuttingDown marks the worker as not ready
+func (this *Health) ShuttingDown() {
+	if this == nil {
+		return
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.shuttingDown = true
+}
+
+// Health is ok, if the fetch loops of all topics are running and have succeeded within health_max_fetch_age (or have been started within this duration)
+// with multiple topics, last_fetch_success is the oldest success of all loops and last_fetch_error is prefixed with the topic
+func (this *Health) Health() (status HealthStatus, ok bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	status = HealthStatus{
+		ShuttingDown:       this.shuttingDown,
+		CamundaLoopRunning: len(this.loops) > 0,
+	}
+	ok = len(this.loops) > 0
+	topics := []string{}
+	for topic := range this.loops {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	allFetched := true
+	oldestSuccess := time.Time{}
+	for _, topic := range topics {
+		loop := this.loops[topic]
+		status.CamundaLoopRunning = status.CamundaLoopRunning && loop.running
+		if loop.lastError != "" && status.LastFetchError == "" {
+			status.LastFetchError = loop.lastError
+			if len(topics) > 1 {
+				status.LastFetchError = topic + ": " + loop.lastError
+			}
+		}
+		if loop.lastSuccess.IsZero() {
+			allFetched = false
+		} else if oldestSuccess.IsZero() || loop.lastSuccess.Before(oldestSuccess) {
+			oldestSuccess = loop.lastSuccess
+		}
+		reference := loop.lastSuccess
+		if reference.IsZero() {
+			reference = loop.started
+		}
+		ok = ok && loop.running && this.now().Sub(reference) <= this.maxFetchAge
+	}
+	if allFetched && !oldestSuccess.IsZero() {
+		status.LastFetchSuccess = &oldestSuccess
+	}
+	status.Status = getHealthStatusText(ok)
+	return status, ok
+}
+
+// Ready is ok, if the worker is healthy, not shutting down, has fetched at least once and reaches the smart service repository and the auth endpoint
+func (this *Health) Ready() (status HealthStatus, ok bool) {
+	status, ok = this.Health()
+	ok = ok && !status.ShuttingDown && status.LastFetchSuccess != nil
+	authErr, repoErr := this.checkDependencies()
+	status.Auth = getHealthStatusText(authErr == nil)
+	if authErr != nil {
+		status.Auth = authErr.Error()
+	}
+	status.SmartServiceRepository = getHealthStatusText(repoErr == nil)
+	if repoErr != nil {
+		status.SmartServiceRepository = repoErr.Error()
+	}
+	ok = ok && authErr == nil && repoErr == nil
+	status.Status = getHealthStatusText(ok)
+	return status, ok
+}
+
+func (this *Health) checkDependencies() (authErr error, repoErr error) {
+	//serializes checks, so that frequent probes do not pile up requests
+	this.dependencyMux.Lock()
+	defer this.dependencyMux.Unlock()
+	authErr = this.withTimeout(func() error {
+		_, err := this.auth.Ensure()
+		return err
+	})
+	if authErr != nil {
+		return authErr, fmt.Errorf("not checked: %w", authErr)
+	}
+	repoErr = this.withTimeout(func() error {
+		_, err := this.repo.ListModules(model.ModulQuery{Limit: 1})
+		return err
+	})
+	return authErr, repoErr
+}
+
+func (this *Health) withTimeout(f func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), this.checkTimeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- f()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func getHealthStatusText(ok bool) string {
+	if ok {
+		return HealthStatusOk
+	}
+	return HealthStatusUnavailable
+}
+
+// GET /health and GET /ready respond with 200 or 503 and a HealthStatus
+func (this *Health) Endpoints(router *httprouter.Router) {
+	router.GET("/health", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		writeHealthStatus(writer, this.Health)
+	})
+	router.GET("/ready", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		writeHealthStatus(writer, this.Ready)
+	})
+}
+
+func writeHealthStatus(writer http.ResponseWriter, check func() (HealthStatus, bool)) {
+	status, ok := check()
+	writer.Header().Set("Content-Type", "application/json")
+	if !ok {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(writer).Encode(status)
+}
@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// ModuleRevision is the state of a module after it has been written (or before it has been deleted) by the worker
+type ModuleRevision struct {
+	Revision          int                          `json:"revision"`
+	ModuleId          string                       `json:"module_id"`
+	Keys              []string                     `json:"keys"`
+	ProcessInstanceId string                       `json:"process_instance_id"`
+	TaskId            string                       `json:"task_id"`
+	Type              string                       `json:"type"` //type of the module event that caused the revision
+	Time              time.Time                    `json:"time"`
+	Module            model.SmartServiceModuleInit `json:"module"`
+}
+
+// HistoryStore is an append only store of module revisions
+type HistoryStore interface {
+	// Add sets and returns the revision number and appends the revision
+	Add(revision ModuleRevision) (ModuleRevision, error)
+	// List returns the revisions of a module, ordered by revision number
+	List(moduleId string) ([]ModuleRevision, error)
+}
+
+// FileHistoryStore stores the revisions of each module as json lines in a file of dir
+// the revision numbers are counted by the store, so dir must not be shared by several replicas of the worker
+type FileHistoryStore struct {
+	dir       string
+	mux       sync.Mutex
+	revisions map[string]int //last revision number per module; read from the file on the first Add of the module
+}
+
+func NewFileHistoryStore(dir string) (*FileHistoryStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileHistoryStore{dir: dir, revisions: map[string]int{}}, nil
+}
+
+func (this *FileHistoryStore) getFileName(moduleId string) string {
+	return filepath.Join(this.dir, url.PathEscape(moduleId)+".jsonl")
+}
+
+func (this *FileHistoryStore) Add(revision ModuleRevision) (ModuleRevision, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	last, ok := this.revisions[revision.ModuleId]
+	if !ok {
+		existing, err := this.list(revision.ModuleId)
+		if err != nil {
+			return revision, err
+		}
+		last = len(existing)
+	}
+	revision.Revision = last + 1
+	line, err := json.Marshal(revision)
+	if err != nil {
+		return revision, err
+	}
+	file, err := os.OpenFile(this.getFileName(revision.ModuleId), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return revision, err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		delete(this.revisions, revision.ModuleId) //the file may contain a part of the line
+		return revision, err
+	}
+	this.revisions[revision.ModuleId] = revision.Revision
+	return revision, file.Sync()
+}
+
+func (this *FileHistoryStore) List(moduleId string) ([]ModuleRevision, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.list(moduleId)
+}
+
+func (this *FileHistoryStore) list(moduleId string) (result []ModuleRevision, err error) {
+	result = []ModuleRevision{}
+	file, err := os.Open(this.getFileName(moduleId))
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		revision := ModuleRevision{}
+		err = json.Unmarshal(scanner.Bytes(), &revision)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, revision)
+	}
+	return result, scanner.Err()
+}
+
+func (this *SmartServiceRepository) recordRevisions(modules []model.Module, events []ModuleEvent) {
+	if this.history == nil {
+		return
+	}
+	eventsByModule := map[string]ModuleEvent{}
+	for _, event := range events {
+		eventsByModule[event.ModuleId] = event
+	}
+	for _, module := range modules {
+		event := eventsByModule[module.Id]
+		_, err := this.history.Add(ModuleRevision{
+			ModuleId:          module.Id,
+			Keys:              module.Keys,
+			ProcessInstanceId: module.ProcesInstanceId,
+			TaskId:            event.TaskId,
+			Type:              event.Type,
+			Time:              time.Now(),
+			Module:            module.SmartServiceModuleInit,
+		})
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to record module revision", "error", err, "moduleId", module.Id)
+		}
+	}
+}
+
+func (this *SmartServiceRepository) ListModuleRevisions(moduleId string) ([]ModuleRevision, error) {
+	if this.history == nil {
+		return []ModuleRevision{}, nil
+	}
+	return this.history.List(moduleId)
+}
+
+// RestoreModuleRevision writes the content of a recorded revision through the process instance of the revision
+// the restore is checked against the current state of the module, so that a concurrent write is not overwritten unnoticed
+// (ErrConcurrentModification, see SendCheckedModules); removed modules are restored without check
+// the restored module is recorded as new revision
+func (this *SmartServiceRepository) RestoreModuleRevision(moduleId string, revision int) (result ModuleRevision, err error) {
+	revisions, err := this.ListModuleRevisions(moduleId)
+	if err != nil {
+		return result, err
+	}
+	found := false
+	for _, r := range revisions {
+		if r.Revision == revision {
+			result = r
+			found = true
+		}
+	}
+	if !found {
+		return result, ErrRevisionNotFound
+	}
+	module := model.Module{
+		Id:                     result.ModuleId,
+		ProcesInstanceId:       result.ProcessInstanceId,
+		SmartServiceModuleInit: result.Module,
+	}
+	versions, err := this.getRestoreVersions(module)
+	if err != nil {
+		return result, err
+	}
+	_, err = this.SendCheckedModules([]model.Module{module}, nil, versions, []ModuleEvent{newModuleEvent(ModuleRestored, model.CamundaExternalTask{Id: result.TaskId}, module)})
+	if err != nil {
+		return result, err
+	}
+	this.libConfig.GetLogger().Info("restored module revision", "moduleId", moduleId, "revision", revision)
+	return result, nil
+}
+
+func (this *SmartServiceRepository) getRestoreVersions(module model.Module) (versions map[string]string, err error) {
+	userId, err := this.GetInstanceUser(module.ProcesInstanceId)
+	if err != nil {
+		return nil, err
+	}
+	current, err, code := this.GetModule(userId, module.Id)
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	version, err := getModuleVersion(current.SmartServiceModuleInit)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{module.Id: version}, nil
+}
+
+// GET /modules/:id/revisions lists the revisions of a module, POST /modules/:id/revisions/:revision/restore restores one
+func (this *SmartServiceRepository) HistoryEndpoints(router *httprouter.Router) {
+	if this.history == nil {
+		return
+	}
+	router.GET("/modules/:id/revisions", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		result, err := this.ListModuleRevisions(params.ByName("id"))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(result)
+	})
+	router.POST("/modules/:id/revisions/:revision/restore", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		revision, err := strconv.Atoi(params.ByName("revision"))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := this.RestoreModuleRevision(params.ByName("id"), revision)
+		if errors.Is(err, ErrRevisionNotFound) {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrConcurrentModification) {
+			http.Error(writer, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(result)
+	})
+}
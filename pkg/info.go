@@ -17,56 +17,292 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/camunda"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Config struct {
-	WorkerParamPrefix                string `json:"worker_param_prefix"`
-	EnableAdditionalModuleDataFields bool   `json:"enable_additional_module_data_fields"`
+	WorkerParamPrefix                string    `json:"worker_param_prefix"`
+	EnableAdditionalModuleDataFields bool      `json:"enable_additional_module_data_fields"`
+	ExpiredModuleSweepInterval       string    `json:"expired_module_sweep_interval"`
+	ExpiredModuleAction              string    `json:"expired_module_action"`
+	ModuleRefreshInterval            string    `json:"module_refresh_interval"`
+	ApiAddress                       string    `json:"api_address"`
+	AdminApiAddress                  string    `json:"admin_api_address"`
+	KafkaUrl                         string    `json:"kafka_url"`
+	ModuleEventTopic                 string    `json:"module_event_topic"`
+	HistoryDir                       string    `json:"history_dir"`
+	HealthMaxFetchAge                string    `json:"health_max_fetch_age"`
+	ShutdownDelay                    string    `json:"shutdown_delay"`
+	TracingExporter                  string    `json:"tracing_exporter"`
+	OtlpEndpoint                     string    `json:"otlp_endpoint"`
+	AuditLog                         string    `json:"audit_log"`
+	EnablePreviewApi                 bool      `json:"enable_preview_api"`
+	AllowedModuleTypes               []string  `json:"allowed_module_types"`
+	RequiredModuleDataFields         []string  `json:"required_module_data_fields"`
+	RequireKey                       bool      `json:"require_key"`
+	RedactedModuleDataFields         []string  `json:"redacted_module_data_fields"`
+	Profiles                         []Profile `json:"profiles"`
+	ConfigReloadInterval             string    `json:"config_reload_interval"`
+	ModuleScriptsDir                 string    `json:"module_scripts_dir"`
+	ModuleScriptTimeout              string    `json:"module_script_timeout"`
+	ModuleScriptProcessAllocLimitMb  int64     `json:"module_script_process_alloc_limit_mb"`
+	ModuleProcessors                 []string  `json:"module_processors"`
+	ModuleDataTemplatesDir           string    `json:"module_data_templates_dir"`
+	ModuleDataTemplatesUrl           string    `json:"module_data_templates_url"`
+	ModuleDataTemplateCacheDuration  string    `json:"module_data_template_cache_duration"`
 }
 
-func New(config Config, libConfig configuration.Config, repo SmartServiceRepo) *Info {
-	return &Info{config: config, libConfig: libConfig, smartServiceRepo: repo}
+// metrics and tracing may be nil
+// processors are appended to the built-in module processors of config.ModuleProcessors
+func New(config Config, libConfig configuration.Config, repo SmartServiceRepo, metrics *Metrics, tracing *Tracing, processors ...ModuleProcessor) *Info {
+	result := &Info{config: config, libConfig: libConfig, smartServiceRepo: repo, metrics: metrics, tracing: tracing, scripts: newModuleScripts(config.ModuleScriptsDir), templates: newModuleDataTemplates(config), now: time.Now}
+	result.processors = append(result.getBuiltInModuleProcessors(), processors...)
+	return result
 }
 
 type Info struct {
 	config           Config
 	libConfig        configuration.Config
 	smartServiceRepo SmartServiceRepo
+	metrics          *Metrics
+	tracing          *Tracing
+	scripts          *moduleScripts
+	templates        *moduleDataTemplates
+	processors       []ModuleProcessor
+	now              func() time.Time
+	rawVariables     sync.Map //task id -> raw task variables, set by the templateRecorder while the task is handled
+	writePlans       sync.Map //task id -> *moduleWritePlan, set by Do until Camunda takes it to write the modules
 }
 
 type SmartServiceRepo interface {
 	GetInstanceUser(instanceId string) (userId string, err error)
 	UseModuleDeleteInfo(info model.ModuleDeleteInfo) error
 	ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	ListModules(query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	ListUserModules(userId string, query model.ModulQuery) (result []model.SmartServiceModule, err error)
+}
+
+// the modules of a task are written after Do by Camunda (see Info.writeModules) with the plan of the task
+type moduleWritePlan struct {
+	task         model.CamundaExternalTask        //with replaced variable references, to handle the task again after a concurrent modification
+	rawVariables map[string]model.CamundaVariable //see templateRecorder
+	versions     map[string]string                //versions of the existing modules, that have been read by Do (including deleted modules)
+	deletes      []model.Module                   //modules removed by mode delete, after the modules have been written
+	events       []ModuleEvent
 }
 
+// Do handles the task and keeps the write plan of its modules until takeWritePlan
 func (this *Info) Do(task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
+	return this.doContext(context.Background(), task)
+}
+
+// Handler returns Info as camunda.Handler, whose spans and repository requests are children of the span of ctx
+func (this *Info) Handler(ctx context.Context) camunda.Handler {
+	return &contextHandler{info: this, ctx: ctx}
+}
+
+type contextHandler struct {
+	info *Info
+	ctx  context.Context
+}
+
+func (this *contextHandler) Do(task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
+	return this.info.doContext(this.ctx, task)
+}
+
+func (this *contextHandler) Undo(modules []model.Module, reason error) {
+	this.info.Undo(modules, reason)
+}
+
+// repo returns the repository of Info, which traces its requests as children of the span of ctx
+// other repositories (e.g. of Render) are not traced
+func (this *Info) repo(ctx context.Context) SmartServiceRepo {
+	if repo, ok := this.smartServiceRepo.(*SmartServiceRepository); ok {
+		return repo.WithContext(ctx)
+	}
+	return this.smartServiceRepo
+}
+
+func (this *Info) doContext(ctx context.Context, task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
+	var rawVariables map[string]model.CamundaVariable
+	if variables, ok := this.rawVariables.Load(task.Id); ok {
+		rawVariables = variables.(map[string]model.CamundaVariable)
+	}
+	modules, outputs, plan, err := this.handleTask(ctx, task, rawVariables)
+	if err != nil {
+		return nil, nil, err
+	}
+	this.writePlans.Store(task.Id, plan)
+	return modules, outputs, nil
+}
+
+// returns nil, if Do has not handled the task (successfully) or the plan has already been taken
+func (this *Info) takeWritePlan(taskId string) *moduleWritePlan {
+	plan, ok := this.writePlans.LoadAndDelete(taskId)
+	if !ok {
+		return nil
+	}
+	return plan.(*moduleWritePlan)
+}
+
+func (this *Info) handleTask(ctx context.Context, task model.CamundaExternalTask, rawVariables map[string]model.CamundaVariable) (modules []model.Module, outputs map[string]interface{}, plan *moduleWritePlan, err error) {
+	ctx, span, end := this.tracing.startTask(ctx, "Info.Do", task)
+	defer func() { end(err) }()
+	span.SetAttributes(attribute.String("module_type", this.getModuleType(task)))
+	if key := this.getModuleKey(task); key != nil {
+		span.SetAttributes(attribute.String("key", *key))
+	}
+	existing := map[string]model.SmartServiceModuleInit{}
+	deletes := []model.Module{}
+	modules, outputs, err = this.getModules(ctx, task, existing, &deletes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	//module processors and module events see the stored data of updated modules migrated to the current version
+	previous, err := this.migrateExistingModules(existing)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i, module := range modules {
+		var existingModule *model.Module
+		if init, ok := previous[module.Id]; ok {
+			existingModule = &model.Module{Id: module.Id, ProcesInstanceId: module.ProcesInstanceId, SmartServiceModuleInit: init}
+		}
+		modules[i].SmartServiceModuleInit, err = this.processModule(ctx, task, module.SmartServiceModuleInit, existingModule)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	//resolveRelations may append moved siblings; only the modules of the task receive its template
+	assembled := len(modules)
+	modules, err = this.resolveRelations(ctx, task.ProcessInstanceId, modules, existing)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if rawVariables != nil {
+		err = this.recordTemplate(task, rawVariables, modules[:assembled])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	versions, err := getModuleVersions(existing)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, module := range deletes {
+		versions[module.Id], err = getModuleVersion(module.SmartServiceModuleInit)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for id, init := range existing {
+		if _, ok := previous[id]; !ok {
+			previous[id] = init //siblings moved by resolveRelations are written without migration
+		}
+	}
+	events, err := getModuleEvents(task, modules, previous)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, module := range deletes {
+		events = append(events, newModuleEvent(ModuleDeleted, task, module))
+	}
+	err = this.setEventUser(ctx, task, events)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	this.logModuleChanges(events)
+	err = this.setDiffOutput(task, events, outputs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return modules, outputs, &moduleWritePlan{task: task, rawVariables: rawVariables, versions: versions, deletes: deletes, events: events}, nil
+}
+
+// sets the instance user, who caused the events, for module events and the audit log
+func (this *Info) setEventUser(ctx context.Context, task model.CamundaExternalTask, events []ModuleEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	userId, err := this.repo(ctx).GetInstanceUser(task.ProcessInstanceId)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].UserId = userId
+	}
+	return nil
+}
+
+// existing receives the stored state of each existing module that is updated
+func (this *Info) getModules(ctx context.Context, task model.CamundaExternalTask, existing map[string]model.SmartServiceModuleInit, deletes *[]model.Module) (modules []model.Module, outputs map[string]interface{}, err error) {
+	entries, isList, err := this.getModuleList(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isList {
+		refresh, err := this.isRefreshEnabled(task)
+		if err != nil {
+			return nil, nil, err
+		}
+		if refresh {
+			return nil, nil, errors.New("refresh may not be used together with modules")
+		}
+		return this.handleModuleList(ctx, task, entries, existing, deletes)
+	}
+	mode, onConflict, err := this.getMode(task)
+	if err != nil {
+		return nil, nil, err
+	}
 	key := this.getModuleKey(task)
 	if key == nil {
-		return this.createModule(task, []string{})
+		err = checkModeWithoutKey(mode)
+		if err != nil {
+			return nil, nil, err
+		}
+		return this.createModule(ctx, task, []string{})
 	} else {
-		existingModule, exists, err := this.getExistingModule(task.ProcessInstanceId, *key)
+		scope, err := this.getKeyScope(task)
+		if err != nil {
+			return nil, nil, err
+		}
+		existingModule, exists, err := this.getExistingModuleInScope(ctx, task.ProcessInstanceId, *key, scope)
 		if err != nil {
 			return nil, nil, err
 		}
+		skip, err := this.handleMode(ctx, task, mode, onConflict, *key, scope, existingModule, exists, deletes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if skip {
+			return []model.Module{}, map[string]interface{}{}, nil
+		}
 		if !exists {
-			return this.createModule(task, []string{*key})
+			return this.createModule(ctx, task, []string{*key})
 		} else {
-			return this.updateModule(task, existingModule, []string{*key})
+			err = recordExistingModule(existing, existingModule.Id, existingModule.SmartServiceModuleInit)
+			if err != nil {
+				return nil, nil, err
+			}
+			return this.updateModule(ctx, task, existingModule, []string{*key})
 		}
 	}
 }
 
-func (this *Info) createModule(task model.CamundaExternalTask, keys []string) ([]model.Module, map[string]interface{}, error) {
-	info, err := this.getSmartServiceModuleInit(task)
+func (this *Info) createModule(ctx context.Context, task model.CamundaExternalTask, keys []string) ([]model.Module, map[string]interface{}, error) {
+	info, err := this.getSmartServiceModuleInit(ctx, task, nil)
 	info.Keys = keys
 	return []model.Module{{
 			Id:                     task.ProcessInstanceId + "." + task.Id,
@@ -77,8 +313,8 @@ func (this *Info) createModule(task model.CamundaExternalTask, keys []string) ([
 		err
 }
 
-func (this *Info) updateModule(task model.CamundaExternalTask, existingModule model.Module, keys []string) ([]model.Module, map[string]interface{}, error) {
-	info, err := this.getSmartServiceModuleInit(task)
+func (this *Info) updateModule(ctx context.Context, task model.CamundaExternalTask, existingModule model.Module, keys []string) ([]model.Module, map[string]interface{}, error) {
+	info, err := this.getSmartServiceModuleInit(ctx, task, &existingModule.SmartServiceModuleInit)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -89,18 +325,31 @@ func (this *Info) updateModule(task model.CamundaExternalTask, existingModule mo
 		nil
 }
 
+// Undo is called for modules that are not written (e.g. if the write fails); Do writes nothing, so there is nothing to undo
 func (this *Info) Undo(modules []model.Module, reason error) {}
 
-func (this *Info) getSmartServiceModuleInit(task model.CamundaExternalTask) (result model.SmartServiceModuleInit, err error) {
+// stored is the stored state of the updated module, whose metadata is kept, or nil for new modules
+func (this *Info) getSmartServiceModuleInit(ctx context.Context, task model.CamundaExternalTask, stored *model.SmartServiceModuleInit) (result model.SmartServiceModuleInit, err error) {
 	this.libConfig.GetLogger().Debug("received task variables", "variables", fmt.Sprintf("%#v", task.Variables))
-	moduleData, err := this.getModuleData(task)
+	moduleData, err := this.getModuleData(ctx, task)
 	if this.config.EnableAdditionalModuleDataFields {
 		for key, value := range this.getModuleDataAdditionalFields(task) {
 			moduleData[key] = value
 		}
 	}
+	moduleType := this.getModuleType(task)
+	if err == nil {
+		moduleData, err = this.migrateTaskModuleData(task, moduleType, moduleData)
+	}
+	var params moduleMetadataParams
+	if err == nil {
+		params, err = this.getTaskModuleMetadataParams(task)
+	}
+	if err == nil {
+		err = this.setModuleMetadata(task.ProcessInstanceId, moduleData, stored, params)
+	}
 	return model.SmartServiceModuleInit{
-		ModuleType: this.getModuleType(task),
+		ModuleType: moduleType,
 		ModuleData: moduleData,
 	}, err
 }
@@ -122,50 +371,135 @@ type KeyValue struct {
 	Value string
 }
 
-func (this *Info) getModuleData(task model.CamundaExternalTask) (result map[string]interface{}, err error) {
-	parts := []KeyValue{}
+func (this *Info) getModuleData(ctx context.Context, task model.CamundaExternalTask) (result map[string]interface{}, err error) {
+	ctx, span, end := this.tracing.startTask(ctx, "Info.getModuleData", task)
+	defer func() { end(err) }()
+	ref, err := this.getModuleDataRef(task)
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	joined, parts, err := this.getJoinedVariable(task, "module_data")
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	if parts == 0 && ref == "" {
+		this.libConfig.GetLogger().Debug("no module_data found")
+		return map[string]interface{}{}, nil
+	}
+	result = map[string]interface{}{}
+	if ref != "" {
+		span.SetAttributes(attribute.String("module_data_ref", ref))
+		result, err = this.templates.get(ref)
+		if err != nil {
+			return map[string]interface{}{}, err
+		}
+	}
+	if parts == 0 {
+		return result, nil
+	}
+	span.SetAttributes(attribute.Int("module_data.parts", parts), attribute.Int("module_data.size", len(joined)))
+	this.metrics.observeModuleData(len(joined), parts)
+	moduleData, err := this.validateModuleData(ctx, task, joined)
+	if err != nil {
+		return moduleData, err
+	}
+	return mergeModuleDataTemplate(result, moduleData), nil
+}
+
+// returns the value of module_data_ref or an empty string if it is not set
+func (this *Info) getModuleDataRef(task model.CamundaExternalTask) (string, error) {
+	variable, ok := task.Variables[this.config.WorkerParamPrefix+ModuleDataRefVariable]
+	if !ok {
+		return "", nil
+	}
+	ref, ok := variable.Value.(string)
+	if !ok {
+		this.metrics.countError(ErrorCauseNotString)
+		return "", errors.New(ModuleDataRefVariable + " is not string")
+	}
+	return ref, nil
+}
+
+// top level fields of moduleData replace the fields of template
+func mergeModuleDataTemplate(template map[string]interface{}, moduleData map[string]interface{}) map[string]interface{} {
+	for key, value := range moduleData {
+		template[key] = value
+	}
+	return template
+}
+
+func (this *Info) validateModuleData(ctx context.Context, task model.CamundaExternalTask, joined string) (result map[string]interface{}, err error) {
+	_, _, end := this.tracing.startTask(ctx, "Info.validateModuleData", task)
+	defer func() { end(err) }()
+	err = json.Unmarshal([]byte(joined), &result)
+	if err != nil {
+		this.metrics.countError(ErrorCauseInvalidJson)
+		this.libConfig.GetLogger().Error("module_data is not valid json", "error", err, "joined", joined)
+		return map[string]interface{}{}, fmt.Errorf("invalid json for module_data: %w, (%v)", err, joined)
+	}
+	return result, nil
+}
+
+// joins all variables starting with WorkerParamPrefix+name, ordered by variable name
+// parts is the number of joined variables; 0 if no variable is found
+func (this *Info) getJoinedVariable(task model.CamundaExternalTask, name string) (joined string, parts int, err error) {
+	values := []KeyValue{}
 	for key, variable := range task.Variables {
-		if strings.HasPrefix(key, this.config.WorkerParamPrefix+"module_data") {
+		if isJoinedVariablePart(key, this.config.WorkerParamPrefix+name) {
 			temp, ok := variable.Value.(string)
 			if !ok {
-				this.libConfig.GetLogger().Debug("module_data is not string", "key", key, "value", variable.Value)
-				return map[string]interface{}{}, errors.New("module_data is not string")
+				this.metrics.countError(ErrorCauseNotString)
+				this.libConfig.GetLogger().Debug(name+" is not string", "key", key, "value", variable.Value)
+				return "", 0, errors.New(name + " is not string")
 			}
-			parts = append(parts, KeyValue{
+			values = append(values, KeyValue{
 				Key:   key,
 				Value: temp,
 			})
 		}
 	}
-	if len(parts) == 0 {
-		this.libConfig.GetLogger().Debug("no module_data found")
-		return map[string]interface{}{}, nil
+	if len(values) == 0 {
+		return "", 0, nil
 	}
-	sort.Slice(parts, func(i, j int) bool {
-		return parts[i].Key < parts[j].Key
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key < values[j].Key
 	})
-	joined := ""
-	for _, part := range parts {
-		joined = joined + part.Value
+	for _, value := range values {
+		joined = joined + value.Value
 	}
-	err = json.Unmarshal([]byte(joined), &result)
-	if err != nil {
-		this.libConfig.GetLogger().Error("module_data is not valid json", "error", err, "joined", joined)
-		return map[string]interface{}{}, fmt.Errorf("invalid json for module_data: %w, (%v)", err, joined)
-	}
-	return result, nil
+	return joined, len(values), nil
+}
+
+// variable names (without WorkerParamPrefix) that are never used as additional module_data fields
+var reservedVariableNames = map[string]bool{
+	"module_data":       true,
+	"module_data_ref":   true,
+	"module_type":       true,
+	"delete_info":       true,
+	"key":               true,
+	ModuleVersionField:  true,
+	"parent_key":        true,
+	"position":          true,
+	"key_scope":         true,
+	"mode":              true,
+	"on_conflict":       true,
+	"ttl":               true,
+	"expires_at":        true,
+	"refresh":           true,
+	"diff_output":       true,
+	ModuleMetadataField: true,
 }
 
 func (this *Info) getModuleDataAdditionalFields(task model.CamundaExternalTask) (result map[string]interface{}) {
 	result = map[string]interface{}{}
 	for key, value := range task.Variables {
-		if strings.HasPrefix(key, this.config.WorkerParamPrefix) && !strings.HasPrefix(key, this.config.WorkerParamPrefix+"module_data") {
+		if strings.HasPrefix(key, this.config.WorkerParamPrefix) && !strings.HasPrefix(key, this.config.WorkerParamPrefix+"module_data") && !strings.HasPrefix(key, this.config.WorkerParamPrefix+"modules") {
 			key = strings.TrimPrefix(key, this.config.WorkerParamPrefix)
 			str, ok := value.Value.(string)
 			if !ok {
 				break
 			}
-			if key != "module_data" && key != "module_type" && key != "delete_info" && key != "key" {
+			if !reservedVariableNames[key] {
 				var temp interface{}
 				err := json.Unmarshal([]byte(str), &temp)
 				if err != nil {
@@ -192,8 +526,10 @@ func (this *Info) getModuleKey(task model.CamundaExternalTask) (key *string) {
 	return nil
 }
 
-func (this *Info) getExistingModule(processInstanceId string, key string) (module model.Module, exists bool, err error) {
-	existingModules, err := this.smartServiceRepo.ListExistingModules(processInstanceId, model.ModulQuery{
+func (this *Info) getExistingModule(ctx context.Context, processInstanceId string, key string) (module model.Module, exists bool, err error) {
+	ctx, span, end := this.tracing.start(ctx, processInstanceId, "Info.getExistingModule", attribute.String("key", key))
+	defer func() { end(err) }()
+	existingModules, err := this.repo(ctx).ListExistingModules(processInstanceId, model.ModulQuery{
 		KeyFilter: &key,
 	})
 	if err != nil {
@@ -210,5 +546,6 @@ func (this *Info) getExistingModule(processInstanceId string, key string) (modul
 	module.SmartServiceModuleInit = existingModules[0].SmartServiceModuleInit
 	module.ProcesInstanceId = processInstanceId
 	module.Id = existingModules[0].Id
+	span.SetAttributes(attribute.String("module_id", module.Id))
 	return module, true, nil
 }
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/segmentio/kafka-go"
+)
+
+type KafkaProducer struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaProducer writes to config.ModuleEventTopic until ctx is done
+func NewKafkaProducer(ctx context.Context, wg *sync.WaitGroup, config Config, libConfig configuration.Config) *KafkaProducer {
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(config.KafkaUrl),
+		Topic:                  config.ModuleEventTopic,
+		Balancer:               &kafka.Hash{},
+		BatchTimeout:           10 * time.Millisecond,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		//module events are published while tasks are handled; async writes prevent an unavailable kafka from blocking the tasks
+		Async: true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err == nil {
+				return
+			}
+			for _, message := range messages {
+				libConfig.GetLogger().Error("unable to publish module event", "error", err, "moduleId", string(message.Key))
+			}
+		},
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		err := writer.Close()
+		if err != nil {
+			libConfig.GetLogger().Error("unable to close kafka writer", "error", err)
+		}
+	}()
+	return &KafkaProducer{writer: writer}
+}
+
+// Produce queues the message; write errors are logged by the writer, so the returned error only reports invalid messages or a closed writer
+func (this *KafkaProducer) Produce(key string, message []byte) error {
+	return this.writer.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(key),
+		Value: message,
+	})
+}
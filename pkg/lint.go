@@ -0,0 +1,479 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const LintSeverityError = "error"
+const LintSeverityWarning = "warning"
+
+// LintFinding is a problem of an info task in a bpmn file
+type LintFinding struct {
+	File      string `json:"file,omitempty"`
+	ProcessId string `json:"process_id,omitempty"`
+	TaskId    string `json:"task_id,omitempty"`
+	TaskName  string `json:"task_name,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Severity  string `json:"severity"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+// bpmnElement is a generic xml element of a bpmn file
+type bpmnElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr    `xml:",any,attr"`
+	Content  string        `xml:",chardata"`
+	Children []bpmnElement `xml:",any"`
+}
+
+func (this bpmnElement) attr(name string) string {
+	for _, attr := range this.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// bpmnParameter is a camunda input parameter; dynamic parameters are scripts, whose value is unknown before execution
+type bpmnParameter struct {
+	Name      string
+	Value     string
+	IsString  bool
+	IsDynamic bool
+}
+
+type bpmnTask struct {
+	ProcessId  string
+	Id         string
+	Name       string
+	Parameters map[string]bpmnParameter
+}
+
+// expressions (${...}, #{...}) and variable references ({{...}}) are replaced by a value, that is valid json inside and outside of json strings
+var expressionPattern = regexp.MustCompile(`\$\{[^}]*\}|#\{[^}]*\}|\{\{[^}]*\}\}`)
+
+const expressionPlaceholder = "0"
+
+// LintBpmn checks the external tasks of bpmn with the given topic (usually libConfig.CamundaWorkerTopic)
+// file is only used to fill LintFinding.File
+func LintBpmn(config Config, topic string, file string, bpmn []byte) (findings []LintFinding, err error) {
+	root := bpmnElement{}
+	err = xml.NewDecoder(bytes.NewReader(bpmn)).Decode(&root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", file, err)
+	}
+	tasks := findBpmnTasks(root, "", topic)
+	findings = []LintFinding{}
+	for _, task := range tasks {
+		for _, finding := range lintBpmnTask(config, topic, task) {
+			finding.File = file
+			findings = append(findings, finding)
+		}
+	}
+	for _, finding := range lintBpmnModuleTypes(config, topic, tasks) {
+		finding.File = file
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+func findBpmnTasks(element bpmnElement, processId string, topic string) (tasks []bpmnTask) {
+	if element.XMLName.Local == "process" {
+		processId = element.attr("id")
+	}
+	if isBpmnExternalTask(element, topic) {
+		tasks = append(tasks, bpmnTask{
+			ProcessId:  processId,
+			Id:         element.attr("id"),
+			Name:       element.attr("name"),
+			Parameters: getBpmnInputParameters(element),
+		})
+	}
+	for _, child := range element.Children {
+		tasks = append(tasks, findBpmnTasks(child, processId, topic)...)
+	}
+	return tasks
+}
+
+func isBpmnExternalTask(element bpmnElement, topic string) bool {
+	if element.XMLName.Local == "messageEventDefinition" {
+		return false //handled as part of the event
+	}
+	if element.attr("type") == "external" && element.attr("topic") == topic {
+		return true
+	}
+	//external message events define the topic in their event definition
+	for _, child := range element.Children {
+		if child.XMLName.Local == "messageEventDefinition" && child.attr("type") == "external" && child.attr("topic") == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func getBpmnInputParameters(element bpmnElement) map[string]bpmnParameter {
+	result := map[string]bpmnParameter{}
+	var walk func(element bpmnElement)
+	walk = func(element bpmnElement) {
+		for _, child := range element.Children {
+			switch child.XMLName.Local {
+			case "inputParameter":
+				parameter := bpmnParameter{Name: child.attr("name"), Value: child.Content, IsString: true}
+				for _, value := range child.Children {
+					switch value.XMLName.Local {
+					case "script":
+						parameter.IsDynamic = true
+					case "list", "map":
+						parameter.IsString = false
+					}
+				}
+				result[parameter.Name] = parameter
+			case "extensionElements", "inputOutput":
+				walk(child)
+			}
+		}
+	}
+	walk(element)
+	return result
+}
+
+func newLintFinding(task bpmnTask, parameter string, severity string, code string, message string) LintFinding {
+	return LintFinding{
+		ProcessId: task.ProcessId,
+		TaskId:    task.Id,
+		TaskName:  task.Name,
+		Parameter: parameter,
+		Severity:  severity,
+		Code:      code,
+		Message:   message,
+	}
+}
+
+func lintBpmnTask(config Config, topic string, task bpmnTask) (findings []LintFinding) {
+	prefix := config.WorkerParamPrefix
+	names := []string{}
+	for name := range task.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			if suggestion, ok := getBpmnPrefixSuggestion(prefix, name); ok {
+				findings = append(findings, newLintFinding(task, name, LintSeverityWarning, "misspelled_prefix", fmt.Sprintf("parameter is not used by the worker; did you mean %v?", suggestion)))
+			}
+			continue
+		}
+		variable := strings.TrimPrefix(name, prefix)
+		if isBpmnReservedName(variable) {
+			continue
+		}
+		message := "unknown parameter is ignored"
+		if config.EnableAdditionalModuleDataFields {
+			message = "unknown parameter becomes an additional module_data field"
+		}
+		if suggestion, ok := getBpmnNameSuggestion(variable); ok {
+			message = message + fmt.Sprintf("; did you mean %v?", prefix+suggestion)
+		}
+		findings = append(findings, newLintFinding(task, name, LintSeverityWarning, "unknown_parameter", message))
+	}
+
+	hasModuleData := hasBpmnParameter(task, prefix+"module_data")
+	_, hasModuleDataRef := task.Parameters[prefix+ModuleDataRefVariable]
+	hasModules := hasBpmnParameter(task, prefix+"modules")
+	if hasModules {
+		findings = append(findings, lintBpmnJoined(task, prefix+"modules", func(joined string) error {
+			entries := []ModuleListEntry{}
+			err := json.Unmarshal([]byte(joined), &entries)
+			if err != nil {
+				return err
+			}
+			return lintModuleListEntries(entries)
+		})...)
+		if hasModuleData {
+			findings = append(findings, newLintFinding(task, prefix+"module_data", LintSeverityWarning, "module_data_ignored", "module_data is ignored, because modules is set"))
+		}
+		if hasModuleDataRef {
+			findings = append(findings, newLintFinding(task, prefix+ModuleDataRefVariable, LintSeverityWarning, "module_data_ignored", "module_data_ref is ignored, because modules is set"))
+		}
+	} else if hasModuleData {
+		findings = append(findings, lintBpmnJoined(task, prefix+"module_data", func(joined string) error {
+			result := map[string]interface{}{}
+			return json.Unmarshal([]byte(joined), &result)
+		})...)
+	} else if !hasModuleDataRef {
+		findings = append(findings, newLintFinding(task, "", LintSeverityWarning, "missing_module_data", "neither module_data nor modules is set; the module data will be empty"))
+	}
+
+	checks := []struct {
+		name     string
+		validate func(string) (string, error)
+	}{
+		{name: "mode", validate: validateMode},
+		{name: "on_conflict", validate: validateOnConflict},
+		{name: "key_scope", validate: validateKeyScope},
+		{name: ModuleDataRefVariable, validate: validateModuleDataRef},
+	}
+	mode := ModeUpsert
+	for _, check := range checks {
+		parameter, ok := task.Parameters[prefix+check.name]
+		if !ok || !isStaticBpmnParameter(parameter) {
+			continue
+		}
+		value, err := check.validate(parameter.Value)
+		if err != nil {
+			findings = append(findings, newLintFinding(task, parameter.Name, LintSeverityError, "invalid_"+check.name, err.Error()))
+		}
+		if check.name == "mode" {
+			mode = value
+		}
+	}
+	key, hasKey := task.Parameters[prefix+"key"]
+	if hasKey && isStaticBpmnParameter(key) && key.Value == "" {
+		findings = append(findings, newLintFinding(task, key.Name, LintSeverityWarning, "empty_key", "key is empty; the module is created without key"))
+		hasKey = false
+	}
+	if !hasKey && !hasModules {
+		if err := checkModeWithoutKey(mode); err != nil {
+			findings = append(findings, newLintFinding(task, prefix+"mode", LintSeverityError, "mode_without_key", err.Error()))
+		}
+	}
+	return findings
+}
+
+func lintModuleListEntries(entries []ModuleListEntry) error {
+	keys := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Key != "" && keys[entry.Key] {
+			return fmt.Errorf("duplicate key in modules: %v", entry.Key)
+		}
+		keys[entry.Key] = true
+		_, err := validateMode(entry.Mode)
+		if err != nil {
+			return err
+		}
+		_, err = validateKeyScope(entry.KeyScope)
+		if err != nil {
+			return err
+		}
+		if entry.ModuleDataRef != "" {
+			_, err = validateModuleDataRef(entry.ModuleDataRef)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasBpmnParameter(task bpmnTask, prefix string) bool {
+	for name := range task.Parameters {
+		if isJoinedVariablePart(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isStaticBpmnParameter(parameter bpmnParameter) bool {
+	return parameter.IsString && !parameter.IsDynamic && !expressionPattern.MatchString(parameter.Value)
+}
+
+// joins the parameters starting with prefix like Info.getJoinedVariable and validates the result
+func lintBpmnJoined(task bpmnTask, prefix string, validate func(joined string) error) (findings []LintFinding) {
+	parts := []bpmnParameter{}
+	for _, parameter := range task.Parameters {
+		if isJoinedVariablePart(parameter.Name, prefix) {
+			parts = append(parts, parameter)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Name < parts[j].Name
+	})
+	joined := ""
+	for _, part := range parts {
+		if !part.IsString {
+			findings = append(findings, newLintFinding(task, part.Name, LintSeverityError, "not_string", "parameter must be a string"))
+			return findings
+		}
+		if part.IsDynamic {
+			findings = append(findings, newLintFinding(task, part.Name, LintSeverityWarning, "dynamic_value", "scripts are not evaluated; the joined value is not validated"))
+			return findings
+		}
+		joined = joined + part.Value
+	}
+	err := validate(expressionPattern.ReplaceAllString(joined, expressionPlaceholder))
+	if finding, ok := lintBpmnPartOrder(task, prefix, parts, err, validate); ok {
+		findings = append(findings, finding)
+	}
+	if err != nil {
+		findings = append(findings, newLintFinding(task, prefix, LintSeverityError, "invalid_json", fmt.Sprintf("joined value of %v parts is invalid: %v", len(parts), err.Error())))
+	}
+	return findings
+}
+
+var bpmnPartNumberPattern = regexp.MustCompile(`(\d+)$`)
+
+// parts are joined in lexicographic order of their names, which differs from the numeric order for e.g. module_data_2 and module_data_10
+// the finding is an error, if only the numeric order results in a valid value; otherwise the lexicographic order may be intended (e.g. _1, _200, _3)
+func lintBpmnPartOrder(task bpmnTask, prefix string, parts []bpmnParameter, joinedErr error, validate func(joined string) error) (finding LintFinding, ok bool) {
+	numbers := map[string]int{}
+	last := -1
+	for _, part := range parts {
+		match := bpmnPartNumberPattern.FindString(strings.TrimPrefix(part.Name, prefix))
+		if match == "" {
+			continue
+		}
+		number, err := strconv.Atoi(match)
+		if err != nil {
+			continue
+		}
+		numbers[part.Name] = number
+		if number < last && !ok {
+			finding, ok = newLintFinding(task, part.Name, LintSeverityWarning, "part_order", "parts are joined in lexicographic order of their names; use numbers of equal length (e.g. _01, _02, ... _10)"), true
+		}
+		last = number
+	}
+	if !ok || joinedErr == nil {
+		return finding, ok
+	}
+	numeric := slices.Clone(parts)
+	sort.SliceStable(numeric, func(i, j int) bool {
+		return numbers[numeric[i].Name] < numbers[numeric[j].Name]
+	})
+	joined := ""
+	for _, part := range numeric {
+		joined = joined + part.Value
+	}
+	if validate(expressionPattern.ReplaceAllString(joined, expressionPlaceholder)) == nil {
+		finding.Severity = LintSeverityError
+		finding.Message = finding.Message + "; the parts are only valid in numeric order"
+	}
+	return finding, ok
+}
+
+// tasks using the same key in a process write the same module and should use the same module type
+func lintBpmnModuleTypes(config Config, topic string, tasks []bpmnTask) (findings []LintFinding) {
+	type keyRef struct {
+		processId string
+		key       string
+	}
+	firstTypes := map[keyRef]string{}
+	for _, task := range tasks {
+		key, ok := task.Parameters[config.WorkerParamPrefix+"key"]
+		if !ok || !isStaticBpmnParameter(key) || key.Value == "" {
+			continue
+		}
+		moduleType := topic
+		if parameter, ok := task.Parameters[config.WorkerParamPrefix+"module_type"]; ok {
+			if !isStaticBpmnParameter(parameter) {
+				continue
+			}
+			moduleType = parameter.Value
+		}
+		ref := keyRef{processId: task.ProcessId, key: key.Value}
+		first, ok := firstTypes[ref]
+		if !ok {
+			firstTypes[ref] = moduleType
+			continue
+		}
+		if first != moduleType {
+			findings = append(findings, newLintFinding(task, config.WorkerParamPrefix+"module_type", LintSeverityError, "inconsistent_module_type", fmt.Sprintf("module type %v differs from module type %v of other tasks with key %v", moduleType, first, key.Value)))
+		}
+	}
+	return findings
+}
+
+// returns the name with the correct prefix, if name looks like a misspelled or missing prefix (e.g. Info.key, info_key, module_data)
+func getBpmnPrefixSuggestion(prefix string, name string) (string, bool) {
+	rest := name
+	base := strings.TrimRight(prefix, "._-:")
+	if base != "" && len(name) > len(base) && strings.EqualFold(name[:len(base)], base) {
+		rest = strings.TrimLeft(name[len(base):], "._-: ")
+	}
+	if isBpmnReservedName(rest) {
+		return prefix + rest, true
+	}
+	if rest == name {
+		return "", false
+	}
+	if suggestion, ok := getBpmnNameSuggestion(rest); ok {
+		return prefix + suggestion, true
+	}
+	return "", false
+}
+
+func isBpmnReservedName(name string) bool {
+	return reservedVariableNames[name] || strings.HasPrefix(name, "module_data") || strings.HasPrefix(name, "modules")
+}
+
+// returns a reserved name with a small edit distance to name (1 for short names, 2 for longer names)
+func getBpmnNameSuggestion(name string) (string, bool) {
+	candidates := []string{"modules"}
+	for candidate := range reservedVariableNames {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	best := ""
+	bestDistance := 3
+	if len(name) <= 5 {
+		bestDistance = 2
+	}
+	for _, candidate := range candidates {
+		if candidate == name {
+			return "", false
+		}
+		distance := getEditDistance(strings.ToLower(name), candidate)
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best, best != ""
+}
+
+func getEditDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
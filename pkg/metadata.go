@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// reserved ModuleData field, managed by the worker
+const ModuleMetadataField = "_meta"
+
+type ModuleMetadata struct {
+	ParentKey         string          `json:"parent_key,omitempty"`
+	ParentId          string          `json:"parent_id,omitempty"`
+	Position          *int            `json:"position,omitempty"`
+	ExpiresAt         *time.Time      `json:"expires_at,omitempty"`
+	ProcessInstanceId string          `json:"process_instance_id,omitempty"` //process instance the module is written through; needed to remove expired modules and to refresh templates
+	Template          *ModuleTemplate `json:"template,omitempty"`
+}
+
+func getModuleMetadata(data map[string]interface{}) (meta ModuleMetadata, ok bool) {
+	value, ok := data[ModuleMetadataField]
+	if !ok {
+		return meta, false
+	}
+	temp, err := json.Marshal(value)
+	if err != nil {
+		return meta, false
+	}
+	err = json.Unmarshal(temp, &meta)
+	if err != nil {
+		return meta, false
+	}
+	return meta, true
+}
+
+func setModuleMetadata(data map[string]interface{}, meta ModuleMetadata) {
+	data[ModuleMetadataField] = meta
+}
+
+// metadata given by the worker parameters of a task or an entry of modules; unset fields keep the stored metadata
+type moduleMetadataParams struct {
+	ParentKey string
+	Position  *int
+	TTL       string
+	ExpiresAt string
+}
+
+func (this *Info) getTaskModuleMetadataParams(task model.CamundaExternalTask) (params moduleMetadataParams, err error) {
+	if variable, ok := task.Variables[this.config.WorkerParamPrefix+"parent_key"]; ok && variable.Value != nil {
+		parentKey, ok := variable.Value.(string)
+		if !ok {
+			return params, errors.New("parent_key is not string")
+		}
+		params.ParentKey = parentKey
+	}
+	if variable, ok := task.Variables[this.config.WorkerParamPrefix+"position"]; ok && variable.Value != nil {
+		position, ok := parseIntValue(variable.Value)
+		if !ok {
+			return params, fmt.Errorf("invalid position: %v", variable.Value)
+		}
+		params.Position = &position
+	}
+	params.TTL, err = this.getStringVariable(task, "ttl")
+	if err != nil {
+		return params, err
+	}
+	params.ExpiresAt, err = this.getStringVariable(task, "expires_at")
+	if err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// sets the metadata of moduleData from the metadata of the stored module (nil for new modules) and params
+// the metadata is managed by the worker; a _meta field of the task input (module_data, modules, templates) is never used
+func (this *Info) setModuleMetadata(processInstanceId string, moduleData map[string]interface{}, stored *model.SmartServiceModuleInit, params moduleMetadataParams) error {
+	delete(moduleData, ModuleMetadataField)
+	meta := ModuleMetadata{}
+	if stored != nil {
+		meta, _ = getModuleMetadata(stored.ModuleData)
+	}
+	if params.ParentKey != "" {
+		meta.ParentKey = params.ParentKey
+	}
+	if params.Position != nil {
+		meta.Position = params.Position
+	}
+	if params.TTL != "" || params.ExpiresAt != "" {
+		expiresAt, err := parseExpiry(params.TTL, params.ExpiresAt, this.now())
+		if err != nil {
+			return err
+		}
+		meta.ExpiresAt = expiresAt
+		meta.ProcessInstanceId = processInstanceId
+	}
+	if meta != (ModuleMetadata{}) {
+		setModuleMetadata(moduleData, meta)
+	}
+	return nil
+}
+
+// ttl is a duration (e.g. "24h"), expiresAt a RFC3339 timestamp; only one of them may be set
+func parseExpiry(ttl string, expiresAt string, now time.Time) (*time.Time, error) {
+	if ttl != "" && expiresAt != "" {
+		return nil, errors.New("ttl and expires_at may not be used together")
+	}
+	if ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		result := now.Add(duration).UTC()
+		return &result, nil
+	}
+	result, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_at: %w", err)
+	}
+	result = result.UTC()
+	return &result, nil
+}
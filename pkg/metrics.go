@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const ErrorCauseNotString = "not_string"
+const ErrorCauseInvalidJson = "invalid_json"
+const ErrorCauseRepository = "repository_error"
+
+// module_type label of modules with a type, that is not known to the metrics (see Metrics.setModuleTypes)
+const MetricsOtherModuleType = "other"
+
+// Metrics may be nil, to disable metrics
+type Metrics struct {
+	registry          *prometheus.Registry
+	modules           *prometheus.CounterVec
+	moduleDataSize    prometheus.Histogram
+	moduleDataParts   prometheus.Histogram
+	repositoryLatency *prometheus.HistogramVec
+	errors            *prometheus.CounterVec
+	moduleTypes       atomic.Pointer[map[string]bool]
+}
+
+func NewMetrics() *Metrics {
+	registry := prometheus.NewRegistry()
+	metrics := &Metrics{
+		registry: registry,
+		modules: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "info_worker",
+			Name:      "modules_total",
+			Help:      "modules written or deleted by the worker, by module type and module event type",
+		}, []string{"module_type", "action"}),
+		moduleDataSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "info_worker",
+			Name:      "module_data_size_bytes",
+			Help:      "size of the joined module_data variables",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+		}),
+		moduleDataParts: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "info_worker",
+			Name:      "module_data_parts",
+			Help:      "number of module_data variables joined to the module data",
+			Buckets:   []float64{1, 2, 5, 10, 50, 100, 500},
+		}),
+		repositoryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "info_worker",
+			Name:      "repository_request_duration_seconds",
+			Help:      "latency of smart service repository requests, by operation",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "info_worker",
+			Name:      "errors_total",
+			Help:      "errors by cause",
+		}, []string{"cause"}),
+	}
+	registry.MustRegister(
+		metrics.modules,
+		metrics.moduleDataSize,
+		metrics.moduleDataParts,
+		metrics.repositoryLatency,
+		metrics.errors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	metrics.moduleTypes.Store(&map[string]bool{})
+	return metrics
+}
+
+// module types are task controlled; to bound the label values, only the allowed_module_types and topics of the profiles are used as module_type label
+func (this *Metrics) setModuleTypes(profiles []Profile) {
+	if this == nil {
+		return
+	}
+	moduleTypes := map[string]bool{}
+	for _, moduleType := range getProfileModuleTypes(profiles) {
+		moduleTypes[moduleType] = true
+	}
+	this.moduleTypes.Store(&moduleTypes)
+}
+
+// GET /metrics
+func (this *Metrics) Endpoints(router *httprouter.Router) {
+	if this == nil {
+		return
+	}
+	router.Handler("GET", "/metrics", promhttp.HandlerFor(this.registry, promhttp.HandlerOpts{}))
+}
+
+func (this *Metrics) countModule(moduleType string, action string) {
+	if this == nil {
+		return
+	}
+	if !(*this.moduleTypes.Load())[moduleType] {
+		moduleType = MetricsOtherModuleType
+	}
+	this.modules.WithLabelValues(moduleType, action).Inc()
+}
+
+func (this *Metrics) observeModuleData(size int, parts int) {
+	if this == nil {
+		return
+	}
+	this.moduleDataSize.Observe(float64(size))
+	this.moduleDataParts.Observe(float64(parts))
+}
+
+func (this *Metrics) countError(cause string) {
+	if this == nil {
+		return
+	}
+	this.errors.WithLabelValues(cause).Inc()
+}
+
+// records the latency of a repository request started at start; a non nil err is counted as repository error
+func (this *Metrics) observeRepositoryRequest(operation string, start time.Time, err error) {
+	if this == nil {
+		return
+	}
+	this.repositoryLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		this.countError(ErrorCauseRepository)
+	}
+}
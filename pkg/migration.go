@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const ModuleVersionField = "module_version"
+
+// MigrationFunc upgrades module data by exactly one version
+type MigrationFunc func(data map[string]interface{}) (map[string]interface{}, error)
+
+var migrations = map[string]map[int]MigrationFunc{}
+var migrationsMux sync.RWMutex
+
+// RegisterMigration registers a step that upgrades the module data of moduleType from version `from` to `from+1`.
+// module data without a version is treated as version 1.
+func RegisterMigration(moduleType string, from int, migration MigrationFunc) {
+	migrationsMux.Lock()
+	defer migrationsMux.Unlock()
+	if _, ok := migrations[moduleType]; !ok {
+		migrations[moduleType] = map[int]MigrationFunc{}
+	}
+	migrations[moduleType][from] = migration
+}
+
+// returns the version reached after applying all registered migrations of moduleType
+// ok is false if no migration is registered for moduleType
+func getCurrentModuleVersion(moduleType string) (version int, ok bool) {
+	migrationsMux.RLock()
+	defer migrationsMux.RUnlock()
+	steps, ok := migrations[moduleType]
+	if !ok || len(steps) == 0 {
+		return 0, false
+	}
+	for from := range steps {
+		if from+1 > version {
+			version = from + 1
+		}
+	}
+	return version, true
+}
+
+func getMigration(moduleType string, from int) (migration MigrationFunc, ok bool) {
+	migrationsMux.RLock()
+	defer migrationsMux.RUnlock()
+	migration, ok = migrations[moduleType][from]
+	return migration, ok
+}
+
+// migrates data of moduleType from version to the current version and sets the module_version field
+// data of module types without registered migrations is only marked with the given version
+func migrateModuleData(moduleType string, version *int, data map[string]interface{}) (map[string]interface{}, error) {
+	current, ok := getCurrentModuleVersion(moduleType)
+	if !ok {
+		if version != nil {
+			data[ModuleVersionField] = *version
+		}
+		return data, nil
+	}
+	v := 1
+	if version != nil {
+		v = *version
+	}
+	var err error
+	for ; v < current; v++ {
+		migration, ok := getMigration(moduleType, v)
+		if !ok {
+			return data, fmt.Errorf("missing migration for module_type %v from version %v", moduleType, v)
+		}
+		data, err = migration(data)
+		if err != nil {
+			return data, fmt.Errorf("unable to migrate module_type %v from version %v: %w", moduleType, v, err)
+		}
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+	}
+	data[ModuleVersionField] = v
+	return data, nil
+}
+
+func (this *Info) getModuleVersion(task model.CamundaExternalTask) (version *int, err error) {
+	variable, ok := task.Variables[this.config.WorkerParamPrefix+ModuleVersionField]
+	if !ok || variable.Value == nil {
+		return nil, nil
+	}
+	result, ok := parseIntValue(variable.Value)
+	if !ok {
+		return nil, fmt.Errorf("invalid %v: %v", ModuleVersionField, variable.Value)
+	}
+	return &result, nil
+}
+
+// version is read from the module_version variable or, if missing, from the module_version field of the module data
+func (this *Info) migrateTaskModuleData(task model.CamundaExternalTask, moduleType string, moduleData map[string]interface{}) (map[string]interface{}, error) {
+	version, err := this.getModuleVersion(task)
+	if err != nil {
+		return moduleData, err
+	}
+	if version == nil {
+		version, err = getModuleDataVersion(moduleData)
+		if err != nil {
+			return moduleData, err
+		}
+	}
+	return migrateModuleData(moduleType, version, moduleData)
+}
+
+// returns copies of the existing modules, migrated to the current version of their module type
+// stored data that can not be migrated is kept as is, because it is replaced by the task anyway
+func (this *Info) migrateExistingModules(existing map[string]model.SmartServiceModuleInit) (result map[string]model.SmartServiceModuleInit, err error) {
+	result = map[string]model.SmartServiceModuleInit{}
+	for id, init := range existing {
+		err = recordExistingModule(result, id, init)
+		if err != nil {
+			return nil, err
+		}
+		migrated, err := this.migrateExistingModule(id, result[id])
+		if err != nil {
+			this.libConfig.GetLogger().Warn("unable to migrate existing module", "error", err, "moduleId", id)
+			err = recordExistingModule(result, id, init)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result[id] = migrated
+	}
+	return result, nil
+}
+
+func (this *Info) migrateExistingModule(id string, init model.SmartServiceModuleInit) (model.SmartServiceModuleInit, error) {
+	if init.ModuleData == nil {
+		init.ModuleData = map[string]interface{}{}
+	}
+	version, err := getModuleDataVersion(init.ModuleData)
+	if err != nil {
+		return init, fmt.Errorf("existing module %v: %w", id, err)
+	}
+	data, err := migrateModuleData(init.ModuleType, version, init.ModuleData)
+	if err != nil {
+		return init, err
+	}
+	init.ModuleData, err = normalizeModuleData(data)
+	return init, err
+}
+
+// returns nil if data has no module_version field
+func getModuleDataVersion(data map[string]interface{}) (version *int, err error) {
+	value, ok := data[ModuleVersionField]
+	if !ok {
+		return nil, nil
+	}
+	result, ok := parseIntValue(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid %v in module_data: %v", ModuleVersionField, value)
+	}
+	return &result, nil
+}
+
+func parseIntValue(value interface{}) (version int, ok bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		result, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, false
+		}
+		return result, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const ModeUpsert = "upsert"
+const ModeCreateOnly = "create_only"
+const ModeUpdateOnly = "update_only"
+const ModeDelete = "delete"
+
+const OnConflictFail = "fail"
+const OnConflictSkip = "skip"
+
+// returns ModeUpsert and OnConflictFail if the variables are not set
+func (this *Info) getMode(task model.CamundaExternalTask) (mode string, onConflict string, err error) {
+	mode, err = this.getStringVariable(task, "mode")
+	if err != nil {
+		return "", "", err
+	}
+	mode, err = validateMode(mode)
+	if err != nil {
+		return "", "", err
+	}
+	onConflict, err = this.getStringVariable(task, "on_conflict")
+	if err != nil {
+		return "", "", err
+	}
+	onConflict, err = validateOnConflict(onConflict)
+	if err != nil {
+		return "", "", err
+	}
+	return mode, onConflict, nil
+}
+
+func (this *Info) getStringVariable(task model.CamundaExternalTask, name string) (string, error) {
+	variable, ok := task.Variables[this.config.WorkerParamPrefix+name]
+	if !ok || variable.Value == nil {
+		return "", nil
+	}
+	result, ok := variable.Value.(string)
+	if !ok {
+		return "", errors.New(name + " is not string")
+	}
+	return result, nil
+}
+
+func validateMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return ModeUpsert, nil
+	case ModeUpsert, ModeCreateOnly, ModeUpdateOnly, ModeDelete:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode: %v", mode)
+	}
+}
+
+func validateOnConflict(onConflict string) (string, error) {
+	switch onConflict {
+	case "":
+		return OnConflictFail, nil
+	case OnConflictFail, OnConflictSkip:
+		return onConflict, nil
+	default:
+		return "", fmt.Errorf("unknown on_conflict: %v", onConflict)
+	}
+}
+
+func checkModeWithoutKey(mode string) error {
+	if mode == ModeUpdateOnly || mode == ModeDelete {
+		return fmt.Errorf("mode %v requires a key", mode)
+	}
+	return nil
+}
+
+// applies mode to the keyed module; if skip is true, the module must not be written
+// modules to delete are appended to deletes and removed after the modules of the task have been written (see SmartServiceRepository.SendCheckedModules)
+func (this *Info) handleMode(ctx context.Context, task model.CamundaExternalTask, mode string, onConflict string, key string, scope string, existingModule model.Module, exists bool, deletes *[]model.Module) (skip bool, err error) {
+	switch {
+	case mode == ModeCreateOnly && exists:
+		return this.handleModeConflict(onConflict, fmt.Errorf("module with key %v already exists", key))
+	case mode == ModeUpdateOnly && !exists:
+		return this.handleModeConflict(onConflict, fmt.Errorf("no module with key %v found", key))
+	case mode == ModeDelete && !exists:
+		this.libConfig.GetLogger().Info("no module to delete found", "key", key)
+		return true, nil
+	case mode == ModeDelete:
+		if scope == KeyScopeUser {
+			err = this.checkInstanceModule(ctx, task.ProcessInstanceId, key, existingModule)
+			if err != nil {
+				return true, err
+			}
+		}
+		*deletes = append(*deletes, existingModule)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (this *Info) handleModeConflict(onConflict string, conflict error) (skip bool, err error) {
+	if onConflict == OnConflictSkip {
+		this.libConfig.GetLogger().Info("skip module", "reason", conflict.Error())
+		return true, nil
+	}
+	return false, conflict
+}
+
+type moduleDeleter interface {
+	UseModuleDeleteInfo(info model.ModuleDeleteInfo) error
+	DeleteModule(processInstanceId string, moduleId string) error
+}
+
+// removes the resources of the delete info of the module and the module itself
+// used for all deletes of the worker (tasks and expired modules); the caller reports the module_deleted event with ModulesChanged
+// module.ProcesInstanceId must be the process instance owning the module
+func deleteStoredModule(repo moduleDeleter, libConfig configuration.Config, module model.Module) error {
+	libConfig.GetLogger().Info("delete module", "moduleId", module.Id, "keys", module.Keys)
+	if module.DeleteInfo != nil {
+		err := repo.UseModuleDeleteInfo(*module.DeleteInfo)
+		if err != nil {
+			return err
+		}
+	}
+	return repo.DeleteModule(module.ProcesInstanceId, module.Id)
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+type ModuleListEntry struct {
+	Key           string                 `json:"key"`
+	ModuleType    string                 `json:"module_type"`
+	ModuleData    map[string]interface{} `json:"module_data"`
+	ModuleDataRef string                 `json:"module_data_ref"`
+	KeyScope      string                 `json:"key_scope"`
+	Mode          string                 `json:"mode"`
+	ParentKey     string                 `json:"parent_key"`
+	Position      *int                   `json:"position"`
+	TTL           string                 `json:"ttl"`
+	ExpiresAt     string                 `json:"expires_at"`
+}
+
+// returns isList == false if no modules variable is set
+func (this *Info) getModuleList(task model.CamundaExternalTask) (entries []ModuleListEntry, isList bool, err error) {
+	joined, parts, err := this.getJoinedVariable(task, "modules")
+	if err != nil {
+		return nil, false, err
+	}
+	if parts == 0 {
+		return nil, false, nil
+	}
+	err = json.Unmarshal([]byte(joined), &entries)
+	if err != nil {
+		this.metrics.countError(ErrorCauseInvalidJson)
+		this.libConfig.GetLogger().Error("modules is not valid json", "error", err, "joined", joined)
+		return nil, true, fmt.Errorf("invalid json for modules: %w, (%v)", err, joined)
+	}
+	keys := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Key == "" {
+			continue
+		}
+		if keys[entry.Key] {
+			return nil, true, fmt.Errorf("duplicate key in modules: %v", entry.Key)
+		}
+		keys[entry.Key] = true
+	}
+	return entries, true, nil
+}
+
+func (this *Info) handleModuleList(ctx context.Context, task model.CamundaExternalTask, entries []ModuleListEntry, existing map[string]model.SmartServiceModuleInit, deletes *[]model.Module) (modules []model.Module, outputs map[string]interface{}, err error) {
+	defaultScope, err := this.getKeyScope(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	defaultMode, onConflict, err := this.getMode(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	modules = []model.Module{}
+	for i, entry := range entries {
+		mode := defaultMode
+		if entry.Mode != "" {
+			mode, err = validateMode(entry.Mode)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if entry.Key == "" {
+			err = checkModeWithoutKey(mode)
+			if err != nil {
+				return nil, nil, err
+			}
+			info, err := this.getModuleListEntryInit(task, entry, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			info.Keys = []string{}
+			modules = append(modules, model.Module{
+				Id:                     getModuleListEntryId(task, "i"+strconv.Itoa(i)),
+				ProcesInstanceId:       task.ProcessInstanceId,
+				SmartServiceModuleInit: info,
+			})
+			continue
+		}
+		scope := defaultScope
+		if entry.KeyScope != "" {
+			scope, err = validateKeyScope(entry.KeyScope)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		existingModule, exists, err := this.getExistingModuleInScope(ctx, task.ProcessInstanceId, entry.Key, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		var stored *model.SmartServiceModuleInit
+		if exists {
+			stored = &existingModule.SmartServiceModuleInit
+		}
+		info, err := this.getModuleListEntryInit(task, entry, stored)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Keys = []string{entry.Key}
+		skip, err := this.handleMode(ctx, task, mode, onConflict, entry.Key, scope, existingModule, exists, deletes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if skip {
+			continue
+		}
+		if !exists {
+			modules = append(modules, model.Module{
+				Id:                     getModuleListEntryId(task, "k"+escapeModuleIdKey(entry.Key)),
+				ProcesInstanceId:       task.ProcessInstanceId,
+				SmartServiceModuleInit: info,
+			})
+			continue
+		}
+		err = recordExistingModule(existing, existingModule.Id, existingModule.SmartServiceModuleInit)
+		if err != nil {
+			return nil, nil, err
+		}
+		existingModule.SmartServiceModuleInit = info
+		modules = append(modules, existingModule)
+	}
+	ids := map[string]bool{}
+	for _, module := range modules {
+		if ids[module.Id] {
+			return nil, nil, fmt.Errorf("duplicate module id in modules: %v", module.Id)
+		}
+		ids[module.Id] = true
+	}
+	return modules, map[string]interface{}{}, nil
+}
+
+// entries without key use the suffix "i<index>", entries with key "k<escaped key>", so that their ids can not collide
+func getModuleListEntryId(task model.CamundaExternalTask, suffix string) string {
+	return task.ProcessInstanceId + "." + task.Id + "." + suffix
+}
+
+// keeps letters, digits and '-' and replaces every other byte with '_' and its hex value, so that ids stay path safe and distinct keys get distinct ids
+func escapeModuleIdKey(key string) string {
+	result := strings.Builder{}
+	for _, b := range []byte(key) {
+		if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || b == '-' {
+			result.WriteByte(b)
+		} else {
+			result.WriteString(fmt.Sprintf("_%02x", b))
+		}
+	}
+	return result.String()
+}
+
+// stored is the stored state of the updated module, whose metadata is kept, or nil for new modules
+func (this *Info) getModuleListEntryInit(task model.CamundaExternalTask, entry ModuleListEntry, stored *model.SmartServiceModuleInit) (result model.SmartServiceModuleInit, err error) {
+	moduleData := entry.ModuleData
+	if moduleData == nil {
+		moduleData = map[string]interface{}{}
+	}
+	if entry.ModuleDataRef != "" {
+		template, err := this.templates.get(entry.ModuleDataRef)
+		if err != nil {
+			return result, err
+		}
+		moduleData = mergeModuleDataTemplate(template, moduleData)
+	}
+	delete(moduleData, ModuleMetadataField)
+	moduleType := entry.ModuleType
+	if moduleType == "" {
+		moduleType = this.getModuleType(task)
+	}
+	version, err := getModuleDataVersion(moduleData)
+	if err != nil {
+		return result, err
+	}
+	moduleData, err = migrateModuleData(moduleType, version, moduleData)
+	if err != nil {
+		return result, err
+	}
+	params := moduleMetadataParams{ParentKey: entry.ParentKey, Position: entry.Position, TTL: entry.TTL, ExpiresAt: entry.ExpiresAt}
+	err = this.setModuleMetadata(task.ProcessInstanceId, moduleData, stored, params)
+	if err != nil {
+		return result, err
+	}
+	return model.SmartServiceModuleInit{
+		ModuleType: moduleType,
+		ModuleData: moduleData,
+	}, nil
+}
@@ -18,21 +18,263 @@ package pkg
 
 import (
 	"context"
-	lib "github.com/SENERGY-Platform/smart-service-module-worker-lib"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SENERGY-Platform/device-repository/lib/client"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/camunda"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/middleware"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/smartservicerepository"
-	"sync"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func Start(ctx context.Context, wg *sync.WaitGroup, config Config, libConfig configuration.Config) error {
-	handlerFactory := func(auth *auth.Auth, smartServiceRepo *smartservicerepository.SmartServiceRepository) (camunda.Handler, error) {
-		return New(
-			config,
-			libConfig,
-			smartServiceRepo,
-		), nil
+// equivalent to lib.Start, but camunda writes modules through SmartServiceRepository to detect concurrent modifications
+// expired modules are swept and stored module templates are refreshed in the background
+// a fetch loop is started for each profile of config (see GetProfiles); the profiles share auth, http clients, the api and the module sinks
+func Start(ctx context.Context, wg *sync.WaitGroup, config Config, libConfig configuration.Config, options ...StartOption) error {
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+	opts := startOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	reloadInterval := time.Duration(0)
+	if opts.reloader != nil && config.ConfigReloadInterval != "" && config.ConfigReloadInterval != "-" {
+		reloadInterval, err = time.ParseDuration(config.ConfigReloadInterval)
+		if err != nil {
+			return fmt.Errorf("invalid config_reload_interval: %w", err)
+		}
+	}
+	producer := opts.producer
+	if producer == nil && config.KafkaUrl != "" && config.KafkaUrl != "-" && config.ModuleEventTopic != "" {
+		producer = NewKafkaProducer(ctx, wg, config, libConfig)
+	}
+	history := opts.history
+	if history == nil && config.HistoryDir != "" && config.HistoryDir != "-" {
+		fileHistory, err := NewFileHistoryStore(config.HistoryDir)
+		if err != nil {
+			return err
+		}
+		history = fileHistory
+	}
+	auditSink := opts.auditSink
+	if auditSink == nil && config.AuditLog != "" && config.AuditLog != "-" {
+		fileAuditSink, err := NewFileAuditSink(config.AuditLog)
+		if err != nil {
+			return err
+		}
+		auditSink = fileAuditSink
+	}
+	tracerProvider := opts.tracerProvider
+	if tracerProvider == nil {
+		var err error
+		tracerProvider, err = NewTracerProvider(ctx, wg, config, libConfig)
+		if err != nil {
+			return err
+		}
+	}
+	tracing := NewTracing(tracerProvider)
+	authentication := auth.New(libConfig)
+	deviceRepo := client.NewClient(libConfig.DeviceRepositoryUrl, nil)
+	metrics := NewMetrics()
+	metrics.setModuleTypes(GetProfiles(config, libConfig))
+	workers := []*profileWorker{}
+	for _, profile := range GetProfiles(config, libConfig) {
+		profileConfig, profileLibConfig := profile.Apply(config, libConfig)
+		libRepo := smartservicerepository.New(profileLibConfig, authentication) //prefixes worker errors with the topic of the profile
+		repo := NewSmartServiceRepository(profileLibConfig, authentication, libRepo, producer, history, metrics, tracing, auditSink)
+		workers = append(workers, &profileWorker{
+			config:    profileConfig,
+			libConfig: profileLibConfig,
+			libRepo:   libRepo,
+			repo:      repo,
+			handler:   New(profileConfig, profileLibConfig, repo, metrics, tracing, opts.processors...),
+		})
+	}
+	first := workers[0]
+	sweeper, err := NewSweeper(config, first.libConfig, first.repo, time.Now)
+	if err != nil {
+		return err
+	}
+	err = sweeper.Start(ctx, wg)
+	if err != nil {
+		return err
+	}
+	refresher := NewRefresher(config, first.libConfig, first.repo, getProfileHandlers(workers)...)
+	err = refresher.Start(ctx, wg)
+	if err != nil {
+		return err
+	}
+	health, err := NewHealth(config, libConfig, first.libRepo, authentication)
+	if err != nil {
+		return err
+	}
+	apiCtx, err := withShutdownDelay(ctx, wg, config, health)
+	if err != nil {
+		return err
+	}
+	previews := &atomic.Pointer[[]*Info]{}
+	profilePreviews := getProfilePreviews(workers)
+	previews.Store(&profilePreviews)
+	endpoints := []func(router *httprouter.Router){metrics.Endpoints, health.Endpoints}
+	if config.EnablePreviewApi {
+		endpoints = append(endpoints, func(router *httprouter.Router) {
+			previewEndpoints(router, func(topic string) (*Info, error) {
+				return selectPreview(*previews.Load(), topic)
+			})
+		})
+	}
+	err = StartApi(apiCtx, wg, config, libConfig, endpoints...)
+	if err != nil {
+		return err
+	}
+	err = StartAdminApi(ctx, wg, config, libConfig, refresher.Endpoints, first.repo.HistoryEndpoints)
+	if err != nil {
+		return err
+	}
+	newCamundaHandler := func(worker *profileWorker) NewHandler {
+		info := worker.handler
+		return func(ctx context.Context) camunda.Handler {
+			m := middleware.New(worker.libConfig, info.Handler(ctx), worker.repo.WithContext(ctx), authentication, deviceRepo)
+			return NewTemplateRecorder(m, info)
+		}
+	}
+	for _, worker := range workers {
+		worker.camunda = NewCamunda(worker.libConfig, worker.repo, newCamundaHandler(worker), worker.handler, health, tracing)
+		err = worker.camunda.Start(ctx, wg)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.reloader != nil {
+		opts.reloader.attach(config, libConfig, func(config Config) {
+			metrics.setModuleTypes(GetProfiles(config, libConfig))
+			sweeper.SetModuleTypes(GetProfiles(config, libConfig))
+			for _, profile := range GetProfiles(config, libConfig) {
+				for _, worker := range workers {
+					if worker.libConfig.CamundaWorkerTopic == profile.CamundaWorkerTopic {
+						worker.config, _ = profile.Apply(config, libConfig)
+						worker.handler = New(worker.config, worker.libConfig, worker.repo, metrics, tracing, opts.processors...)
+						worker.camunda.SetHandler(newCamundaHandler(worker), worker.handler)
+					}
+				}
+			}
+			refresher.SetInfos(getProfileHandlers(workers)...)
+			profilePreviews := getProfilePreviews(workers)
+			previews.Store(&profilePreviews)
+		})
+		if reloadInterval > 0 {
+			opts.reloader.Watch(ctx, wg, reloadInterval)
+		}
+	}
+	return nil
+}
+
+// the clients and handler of a profile
+type profileWorker struct {
+	config    Config
+	libConfig configuration.Config
+	libRepo   *smartservicerepository.SmartServiceRepository
+	repo      *SmartServiceRepository
+	handler   *Info
+	camunda   *Camunda
+}
+
+func getProfileHandlers(workers []*profileWorker) (result []*Info) {
+	for _, worker := range workers {
+		result = append(result, worker.handler)
+	}
+	return result
+}
+
+func getProfilePreviews(workers []*profileWorker) (result []*Info) {
+	for _, worker := range workers {
+		result = append(result, NewPreview(worker.config, worker.libConfig))
+	}
+	return result
+}
+
+// withShutdownDelay returns a context that is done config.ShutdownDelay after ctx,
+// so that the readiness endpoint may report the shutdown before the api stops
+func withShutdownDelay(ctx context.Context, wg *sync.WaitGroup, config Config, health *Health) (context.Context, error) {
+	delay := time.Duration(0)
+	if config.ShutdownDelay != "" && config.ShutdownDelay != "-" {
+		var err error
+		delay, err = time.ParseDuration(config.ShutdownDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shutdown_delay: %w", err)
+		}
+	}
+	delayedCtx, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		<-ctx.Done()
+		health.ShuttingDown()
+		if delay > 0 && config.ApiAddress != "" && config.ApiAddress != "-" {
+			time.Sleep(delay)
+		}
+	}()
+	return delayedCtx, nil
+}
+
+type StartOption func(options *startOptions)
+
+type startOptions struct {
+	producer       ModuleEventProducer
+	history        HistoryStore
+	tracerProvider trace.TracerProvider
+	auditSink      AuditSink
+	reloader       *Reloader
+	processors     []ModuleProcessor
+}
+
+// WithModuleEventProducer publishes module events with producer instead of the configured kafka topic
+func WithModuleEventProducer(producer ModuleEventProducer) StartOption {
+	return func(options *startOptions) {
+		options.producer = producer
+	}
+}
+
+// WithHistoryStore records module revisions in history instead of the configured history_dir
+func WithHistoryStore(history HistoryStore) StartOption {
+	return func(options *startOptions) {
+		options.history = history
+	}
+}
+
+// WithTracerProvider creates spans with provider instead of the configured tracing_exporter
+func WithTracerProvider(provider trace.TracerProvider) StartOption {
+	return func(options *startOptions) {
+		options.tracerProvider = provider
+	}
+}
+
+// WithAuditSink writes audit entries to sink instead of the configured audit_log file
+func WithAuditSink(sink AuditSink) StartOption {
+	return func(options *startOptions) {
+		options.auditSink = sink
+	}
+}
+
+// WithReloader connects reloader to the started profiles; if config_reload_interval is set, the config file is watched
+func WithReloader(reloader *Reloader) StartOption {
+	return func(options *startOptions) {
+		options.reloader = reloader
+	}
+}
+
+// WithModuleProcessors runs processors after the built-in module processors of each profile
+func WithModuleProcessors(processors ...ModuleProcessor) StartOption {
+	return func(options *startOptions) {
+		options.processors = append(options.processors, processors...)
 	}
-	return lib.Start(ctx, wg, libConfig, handlerFactory)
 }
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+const PreviewProcessInstanceId = "preview"
+const PreviewTaskId = "preview"
+
+// max size of the request body of POST /preview
+const PreviewMaxBodySize = 1 << 20
+
+var ErrUnknownPreviewTopic = errors.New("no profile with this topic found")
+
+// PreviewResult contains the module (or modules, if the modules variable is used) the worker would write for the variables
+// Error is the error the task would fail with; Findings are the problems found by the lint checks of bpmn files
+type PreviewResult struct {
+	Module   *model.SmartServiceModuleInit  `json:"module,omitempty"`
+	Modules  []model.SmartServiceModuleInit `json:"modules,omitempty"`
+	Error    string                         `json:"error,omitempty"`
+	Findings []LintFinding                  `json:"findings"`
+}
+
+// NewPreview returns an Info handler without metrics, tracing and smart service repository, which is only used for previews
+func NewPreview(config Config, libConfig configuration.Config) *Info {
+	return New(config, libConfig, &renderRepo{}, nil, nil)
+}
+
+// Preview assembles the modules for the task variables like Do, without reading or writing existing modules
+// module processors receive no existing module
+// variable references ({{.var}}) are not resolved
+func (this *Info) Preview(variables map[string]model.CamundaVariable) (result PreviewResult) {
+	task := model.CamundaExternalTask{Id: PreviewTaskId, ProcessInstanceId: PreviewProcessInstanceId, Variables: variables}
+	result.Findings = this.lintTaskVariables(task)
+	keys := []string{}
+	if key := this.getModuleKey(task); key != nil {
+		keys = []string{*key}
+	}
+	entries, isList, err := this.getModuleList(task)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if !isList {
+		module, err := this.getSmartServiceModuleInit(context.Background(), task, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		module.Keys = keys
+		module, err = this.processModule(context.Background(), task, module, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Module = &module
+		return result
+	}
+	result.Modules = []model.SmartServiceModuleInit{}
+	for _, entry := range entries {
+		module, err := this.getModuleListEntryInit(task, entry, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		module.Keys = []string{}
+		if entry.Key != "" {
+			module.Keys = []string{entry.Key}
+		}
+		module, err = this.processModule(context.Background(), task, module, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Modules = append(result.Modules, module)
+	}
+	return result
+}
+
+func (this *Info) lintTaskVariables(task model.CamundaExternalTask) []LintFinding {
+	bpmn := bpmnTask{Id: task.Id, Parameters: map[string]bpmnParameter{}}
+	for name, variable := range task.Variables {
+		value, isString := variable.Value.(string)
+		bpmn.Parameters[name] = bpmnParameter{Name: name, Value: value, IsString: isString}
+	}
+	findings := lintBpmnTask(this.config, this.libConfig.CamundaWorkerTopic, bpmn)
+	if findings == nil {
+		findings = []LintFinding{}
+	}
+	return findings
+}
+
+// POST /preview receives task variables ({"info.module_data": {"value": "..."}}) and responds with a PreviewResult
+// the optional query parameter topic must match the topic of the info
+func (this *Info) PreviewEndpoints(router *httprouter.Router) {
+	previewEndpoints(router, func(topic string) (*Info, error) {
+		return selectPreview([]*Info{this}, topic)
+	})
+}
+
+// getInfo returns the info used for the request, by the topic query parameter ("" if not set)
+func previewEndpoints(router *httprouter.Router, getInfo func(topic string) (*Info, error)) {
+	router.POST("/preview", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		info, err := getInfo(request.URL.Query().Get("topic"))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+		variables := map[string]model.CamundaVariable{}
+		err = json.NewDecoder(http.MaxBytesReader(writer, request.Body, PreviewMaxBodySize)).Decode(&variables)
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			http.Error(writer, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(info.Preview(variables))
+	})
+}
+
+// returns the preview of the profile with the topic; the first preview is used, if topic is empty
+func selectPreview(previews []*Info, topic string) (*Info, error) {
+	if topic == "" {
+		return previews[0], nil
+	}
+	for _, preview := range previews {
+		if preview.libConfig.CamundaWorkerTopic == topic {
+			return preview, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownPreviewTopic, topic)
+}
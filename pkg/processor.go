@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// ModuleProcessor changes or checks a module after it has been assembled from the task variables and before it is written
+// existing is the stored state of the updated module or nil for new modules; an error fails the task
+type ModuleProcessor interface {
+	Process(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error
+}
+
+type ModuleProcessorFunc func(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error
+
+func (this ModuleProcessorFunc) Process(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error {
+	return this(ctx, task, init, existing)
+}
+
+// names of the built-in module processors, used in config.ModuleProcessors
+const ModuleProcessorValidation = "validation"
+const ModuleProcessorScript = "script"
+const ModuleProcessorRedaction = "redaction"
+
+// used if config.ModuleProcessors is empty
+var DefaultModuleProcessors = []string{ModuleProcessorValidation, ModuleProcessorScript, ModuleProcessorRedaction}
+
+var builtInModuleProcessors = map[string]func(info *Info) ModuleProcessor{
+	ModuleProcessorValidation: func(info *Info) ModuleProcessor { return ModuleProcessorFunc(info.validateModule) },
+	ModuleProcessorScript:     func(info *Info) ModuleProcessor { return ModuleProcessorFunc(info.transformModule) },
+	ModuleProcessorRedaction:  func(info *Info) ModuleProcessor { return ModuleProcessorFunc(info.redactModule) },
+}
+
+// unknown names are rejected by Config.Validate and ignored here
+func (this *Info) getBuiltInModuleProcessors() (result []ModuleProcessor) {
+	names := this.config.ModuleProcessors
+	if len(names) == 0 {
+		names = DefaultModuleProcessors
+	}
+	for _, name := range names {
+		newProcessor, ok := builtInModuleProcessors[name]
+		if !ok {
+			this.libConfig.GetLogger().Error("unable to use module processor", "error", fmt.Errorf("unknown module processor: %v", name))
+			continue
+		}
+		result = append(result, newProcessor(this))
+	}
+	return result
+}
+
+func validateModuleProcessors(names []string) (errs []error) {
+	for _, name := range names {
+		if _, ok := builtInModuleProcessors[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown module processor: %v", name))
+		}
+	}
+	return errs
+}
+
+// processModule runs the module processors in order; processors may change the module data of init
+func (this *Info) processModule(ctx context.Context, task model.CamundaExternalTask, init model.SmartServiceModuleInit, existing *model.Module) (result model.SmartServiceModuleInit, err error) {
+	ctx, _, end := this.tracing.startTask(ctx, "Info.processModule", task)
+	defer func() { end(err) }()
+	for _, processor := range this.processors {
+		err = processor.Process(ctx, task, &init, existing)
+		if err != nil {
+			return init, err
+		}
+	}
+	return init, nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// Profile is a camunda worker with its own topic, task parameters and validation rules
+// all profiles run in one process and share the smart service repository client, auth, api and module sinks
+type Profile struct {
+	CamundaWorkerTopic               string   `json:"camunda_worker_topic"`
+	WorkerParamPrefix                string   `json:"worker_param_prefix"`
+	EnableAdditionalModuleDataFields bool     `json:"enable_additional_module_data_fields"`
+	AllowedModuleTypes               []string `json:"allowed_module_types,omitempty"`
+	RequiredModuleDataFields         []string `json:"required_module_data_fields,omitempty"`
+	RequireKey                       bool     `json:"require_key,omitempty"`
+	RedactedModuleDataFields         []string `json:"redacted_module_data_fields,omitempty"`
+}
+
+// GetProfiles returns config.Profiles or, if no profiles are configured, a single profile with the top level settings
+func GetProfiles(config Config, libConfig configuration.Config) []Profile {
+	if len(config.Profiles) > 0 {
+		return config.Profiles
+	}
+	return []Profile{{
+		CamundaWorkerTopic:               libConfig.CamundaWorkerTopic,
+		WorkerParamPrefix:                config.WorkerParamPrefix,
+		EnableAdditionalModuleDataFields: config.EnableAdditionalModuleDataFields,
+		AllowedModuleTypes:               config.AllowedModuleTypes,
+		RequiredModuleDataFields:         config.RequiredModuleDataFields,
+		RequireKey:                       config.RequireKey,
+		RedactedModuleDataFields:         config.RedactedModuleDataFields,
+	}}
+}
+
+// GetProfile returns the profile with the given camunda topic or, if topic is empty, the first profile
+func GetProfile(config Config, libConfig configuration.Config, topic string) (Profile, error) {
+	profiles := GetProfiles(config, libConfig)
+	if topic == "" {
+		return profiles[0], nil
+	}
+	for _, profile := range profiles {
+		if profile.CamundaWorkerTopic == topic {
+			return profile, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("no profile with topic %v found", topic)
+}
+
+// returns the module types the profiles may write: their topics (the default module type) and their allowed module types
+func getProfileModuleTypes(profiles []Profile) (result []string) {
+	for _, profile := range profiles {
+		result = append(result, profile.CamundaWorkerTopic)
+		result = append(result, profile.AllowedModuleTypes...)
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// returns the module types the info may write
+func (this *Info) getModuleTypes() []string {
+	return getProfileModuleTypes([]Profile{{CamundaWorkerTopic: this.libConfig.CamundaWorkerTopic, AllowedModuleTypes: this.config.AllowedModuleTypes}})
+}
+
+// Apply returns the configs used by the worker of the profile
+func (this Profile) Apply(config Config, libConfig configuration.Config) (Config, configuration.Config) {
+	config.WorkerParamPrefix = this.WorkerParamPrefix
+	config.EnableAdditionalModuleDataFields = this.EnableAdditionalModuleDataFields
+	config.AllowedModuleTypes = this.AllowedModuleTypes
+	config.RequiredModuleDataFields = this.RequiredModuleDataFields
+	config.RequireKey = this.RequireKey
+	config.RedactedModuleDataFields = this.RedactedModuleDataFields
+	config.Profiles = nil
+	libConfig.CamundaWorkerTopic = this.CamundaWorkerTopic
+	return config, libConfig
+}
+
+func validateProfiles(profiles []Profile) (errs []error) {
+	topics := map[string]bool{}
+	for i, profile := range profiles {
+		if profile.CamundaWorkerTopic == "" {
+			errs = append(errs, fmt.Errorf("profiles[%v]: missing camunda_worker_topic", i))
+		} else if topics[profile.CamundaWorkerTopic] {
+			errs = append(errs, fmt.Errorf("profiles[%v]: duplicate camunda_worker_topic %v", i, profile.CamundaWorkerTopic))
+		}
+		topics[profile.CamundaWorkerTopic] = true
+		if profile.WorkerParamPrefix == "" {
+			errs = append(errs, fmt.Errorf("profiles[%v]: missing worker_param_prefix", i))
+		}
+	}
+	return errs
+}
+
+// validation processor: checks the module against allowed_module_types, required_module_data_fields and require_key
+func (this *Info) validateModule(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error {
+	if len(this.config.AllowedModuleTypes) > 0 && !slices.Contains(this.config.AllowedModuleTypes, init.ModuleType) {
+		return fmt.Errorf("module type %v is not allowed for %v", init.ModuleType, this.libConfig.CamundaWorkerTopic)
+	}
+	for _, field := range this.config.RequiredModuleDataFields {
+		if _, ok := init.ModuleData[field]; !ok {
+			return fmt.Errorf("missing required module_data field %v", field)
+		}
+	}
+	if this.config.RequireKey && len(init.Keys) == 0 {
+		return errors.New("missing required key")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// redaction processor: removes the redacted_module_data_fields of the profile from the module data
+// a field is a dot separated path; lists on the path are descended element by element,
+// so that "series.token" removes the token of every entry of the series list
+func (this *Info) redactModule(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error {
+	for _, field := range this.config.RedactedModuleDataFields {
+		redactModuleDataField(init.ModuleData, strings.Split(field, "."))
+	}
+	return nil
+}
+
+func redactModuleDataField(value interface{}, path []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(v, path[0])
+			return
+		}
+		redactModuleDataField(v[path[0]], path[1:])
+	case []interface{}:
+		for _, element := range v {
+			redactModuleDataField(element, path)
+		}
+	}
+}
+
+func validateRedactedModuleDataFields(fields []string, processors []string) (errs []error) {
+	for _, field := range fields {
+		if slices.Contains(strings.Split(field, "."), "") {
+			errs = append(errs, fmt.Errorf("invalid redacted_module_data_fields entry %q: empty path segment", field))
+		}
+	}
+	if len(fields) > 0 && len(processors) > 0 && !slices.Contains(processors, ModuleProcessorRedaction) {
+		errs = append(errs, fmt.Errorf("redacted_module_data_fields requires the %v module processor", ModuleProcessorRedaction))
+	}
+	return errs
+}
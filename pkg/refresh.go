@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/service-commons/pkg/util"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/camunda"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/middleware/references"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+var ErrModuleNotRefreshable = errors.New("module not found or without template")
+
+// raw task variables of a module, before process variable references have been replaced
+type ModuleTemplate struct {
+	TaskId    string                           `json:"task_id"`
+	Topic     string                           `json:"topic,omitempty"`
+	Variables map[string]model.CamundaVariable `json:"variables"`
+}
+
+func (this *Info) isRefreshEnabled(task model.CamundaExternalTask) (bool, error) {
+	variable, ok := task.Variables[this.config.WorkerParamPrefix+"refresh"]
+	if !ok || variable.Value == nil {
+		return false, nil
+	}
+	switch v := variable.Value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if v == "" {
+			return false, nil
+		}
+		result, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("invalid refresh: %w", err)
+		}
+		return result, nil
+	default:
+		return false, fmt.Errorf("invalid refresh: %v", variable.Value)
+	}
+}
+
+// stores the raw worker variables of task as template in the metadata of the modules, if refresh is enabled
+// a template stored by an earlier task is kept, unless refresh is explicitly disabled
+// rawVariables are the task variables before their references have been replaced
+func (this *Info) recordTemplate(task model.CamundaExternalTask, rawVariables map[string]model.CamundaVariable, modules []model.Module) error {
+	refresh, err := this.isRefreshEnabled(model.CamundaExternalTask{Variables: rawVariables})
+	if err != nil {
+		return err
+	}
+	if !refresh {
+		if variable, ok := rawVariables[this.config.WorkerParamPrefix+"refresh"]; ok && variable.Value != nil && variable.Value != "" {
+			removeTemplates(modules)
+		}
+		return nil
+	}
+	variables := map[string]model.CamundaVariable{}
+	for key, variable := range rawVariables {
+		if strings.HasPrefix(key, this.config.WorkerParamPrefix) {
+			variables[key] = variable
+		}
+	}
+	for _, module := range modules {
+		if module.ModuleData == nil {
+			continue
+		}
+		meta, _ := getModuleMetadata(module.ModuleData)
+		meta.Template = &ModuleTemplate{TaskId: task.Id, Topic: this.libConfig.CamundaWorkerTopic, Variables: variables}
+		meta.ProcessInstanceId = task.ProcessInstanceId
+		setModuleMetadata(module.ModuleData, meta)
+	}
+	return nil
+}
+
+func removeTemplates(modules []model.Module) {
+	for _, module := range modules {
+		meta, ok := getModuleMetadata(module.ModuleData)
+		if !ok || meta.Template == nil {
+			continue
+		}
+		meta.Template = nil
+		if meta.ExpiresAt == nil {
+			meta.ProcessInstanceId = ""
+		}
+		if meta == (ModuleMetadata{}) {
+			delete(module.ModuleData, ModuleMetadataField)
+			continue
+		}
+		setModuleMetadata(module.ModuleData, meta)
+	}
+}
+
+// renders the template stored in meta with the given process variables
+// the type, keys and metadata of the existing module are kept
+func (this *Info) renderModuleTemplate(existing model.Module, meta ModuleMetadata, variables map[string]interface{}) (result model.SmartServiceModuleInit, err error) {
+	if meta.Template == nil {
+		return result, ErrModuleNotRefreshable
+	}
+	taskVariables, err := references.Handle(meta.Template.Variables, variables)
+	if err != nil {
+		return result, err
+	}
+	task := model.CamundaExternalTask{
+		Id:                meta.Template.TaskId,
+		ProcessInstanceId: meta.ProcessInstanceId,
+		Variables:         taskVariables,
+	}
+	init, err := this.getSmartServiceModuleInit(context.Background(), task, &existing.SmartServiceModuleInit)
+	if err != nil {
+		return result, err
+	}
+	init.Keys = existing.Keys
+	migrated, err := this.migrateExistingModules(map[string]model.SmartServiceModuleInit{existing.Id: existing.SmartServiceModuleInit})
+	if err != nil {
+		return result, err
+	}
+	previous := existing
+	previous.SmartServiceModuleInit = migrated[existing.Id]
+	init, err = this.processModule(context.Background(), task, init, &previous)
+	if err != nil {
+		return result, err
+	}
+	setModuleMetadata(init.ModuleData, meta)
+	result = existing.SmartServiceModuleInit
+	result.ModuleData, err = normalizeModuleData(init.ModuleData)
+	return result, err
+}
+
+// NewTemplateRecorder wraps the (middleware) handler of info, to store the task variables before their references are replaced
+func NewTemplateRecorder(handler camunda.Handler, info *Info) camunda.Handler {
+	return &templateRecorder{handler: handler, info: info}
+}
+
+type templateRecorder struct {
+	handler camunda.Handler
+	info    *Info
+}
+
+// the raw variables are only kept while the task is handled; Info.Do records them in the modules of the task
+func (this *templateRecorder) Do(task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
+	this.info.rawVariables.Store(task.Id, task.Variables)
+	defer this.info.rawVariables.Delete(task.Id)
+	return this.handler.Do(task)
+}
+
+func (this *templateRecorder) Undo(modules []model.Module, reason error) {
+	this.handler.Undo(modules, reason)
+}
+
+type RefresherRepo interface {
+	ListModules(query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	GetVariables(processId string) (result map[string]interface{}, err error)
+	SendCheckedModules(modules []model.Module, deletes []model.Module, versions map[string]string, events []ModuleEvent) (result []model.SmartServiceModule, err error)
+}
+
+// Refresher re-renders modules with a stored template and writes changed results back to the smart service repository
+type Refresher struct {
+	config    Config
+	libConfig configuration.Config
+	repo      RefresherRepo
+	infosMux  sync.Mutex
+	infos     []*Info
+}
+
+type RefreshResult struct {
+	Refreshed int `json:"refreshed"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+// templates are rendered by the info of the profile with the topic of the template
+// templates with an unknown topic or of a module type, that the profile may not write, are not refreshed
+func NewRefresher(config Config, libConfig configuration.Config, repo RefresherRepo, infos ...*Info) *Refresher {
+	return &Refresher{config: config, libConfig: libConfig, repo: repo, infos: infos}
+}
+
+// SetInfos replaces the infos used for the following refreshes
+func (this *Refresher) SetInfos(infos ...*Info) {
+	this.infosMux.Lock()
+	defer this.infosMux.Unlock()
+	this.infos = infos
+}
+
+// returns the info of the profile, that recorded the template of module, or nil if the module is not refreshable
+func (this *Refresher) getTemplateInfo(module model.SmartServiceModule) *Info {
+	meta, ok := getModuleMetadata(module.ModuleData)
+	if !ok || meta.Template == nil || meta.ProcessInstanceId == "" {
+		return nil
+	}
+	this.infosMux.Lock()
+	defer this.infosMux.Unlock()
+	for _, info := range this.infos {
+		if info.libConfig.CamundaWorkerTopic == meta.Template.Topic && slices.Contains(info.getModuleTypes(), module.ModuleType) {
+			return info
+		}
+	}
+	return nil
+}
+
+// returns the module types of all infos
+func (this *Refresher) getModuleTypes() []string {
+	this.infosMux.Lock()
+	defer this.infosMux.Unlock()
+	profiles := []Profile{}
+	for _, info := range this.infos {
+		profiles = append(profiles, Profile{CamundaWorkerTopic: info.libConfig.CamundaWorkerTopic, AllowedModuleTypes: info.config.AllowedModuleTypes})
+	}
+	return getProfileModuleTypes(profiles)
+}
+
+// runs Refresh every ModuleRefreshInterval until ctx is done; an empty interval disables the scheduled refresh
+func (this *Refresher) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	if this.config.ModuleRefreshInterval == "" || this.config.ModuleRefreshInterval == "-" {
+		return nil
+	}
+	interval, err := time.ParseDuration(this.config.ModuleRefreshInterval)
+	if err != nil {
+		return fmt.Errorf("invalid module_refresh_interval: %w", err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid module_refresh_interval: %v", interval)
+	}
+	ticker := time.NewTicker(interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := this.Refresh()
+				if err != nil {
+					this.libConfig.GetLogger().Error("unable to refresh modules", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// refreshes all modules with a stored template
+func (this *Refresher) Refresh() (result RefreshResult, err error) {
+	modules, err := this.listRefreshableModules()
+	if err != nil {
+		return result, err
+	}
+	for _, module := range modules {
+		changed, err := this.refreshModule(module)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to refresh module", "error", err, "moduleId", module.Id)
+			result.Failed++
+			continue
+		}
+		if changed {
+			result.Refreshed++
+		} else {
+			result.Unchanged++
+		}
+	}
+	this.libConfig.GetLogger().Info("refreshed modules", "refreshed", result.Refreshed, "unchanged", result.Unchanged, "failed", result.Failed)
+	return result, nil
+}
+
+// refreshes the module with the given id; returns ErrModuleNotRefreshable if it does not exist or has no template
+// the module is searched in the module types of the worker, because the id says nothing about the owner of a module
+func (this *Refresher) RefreshModule(id string) (changed bool, err error) {
+	modules, err := this.listRefreshableModules()
+	if err != nil {
+		return false, err
+	}
+	index := slices.IndexFunc(modules, func(module model.SmartServiceModule) bool {
+		return module.Id == id
+	})
+	if index < 0 {
+		return false, ErrModuleNotRefreshable
+	}
+	return this.refreshModule(modules[index])
+}
+
+// lists the modules with a template of the module types of the worker
+func (this *Refresher) listRefreshableModules() (result []model.SmartServiceModule, err error) {
+	for _, moduleType := range this.getModuleTypes() {
+		for module, err := range util.IterBatch(100, func(limit int64, offset int64) ([]model.SmartServiceModule, error) {
+			return this.repo.ListModules(model.ModulQuery{TypeFilter: &moduleType, Limit: limit, Offset: offset})
+		}) {
+			if err != nil {
+				return nil, err
+			}
+			if module.ModuleType == moduleType && this.getTemplateInfo(module) != nil {
+				result = append(result, module)
+			}
+		}
+	}
+	return result, nil
+}
+
+// the template and process instance are read from the module data, so the process instance is confirmed with the repository
+// before its variables are used and the module is written
+func (this *Refresher) refreshModule(module model.SmartServiceModule) (changed bool, err error) {
+	info := this.getTemplateInfo(module)
+	if info == nil {
+		return false, ErrModuleNotRefreshable
+	}
+	meta, _ := getModuleMetadata(module.ModuleData)
+	owned, err := isProcessInstanceModule(this.repo, meta.ProcessInstanceId, module.Id, model.ModulQuery{TypeFilter: &module.ModuleType})
+	if err != nil {
+		return false, err
+	}
+	if !owned {
+		return false, fmt.Errorf("%w: module %v does not belong to process instance %v of its metadata", ErrModuleNotRefreshable, module.Id, meta.ProcessInstanceId)
+	}
+	variables, err := this.repo.GetVariables(meta.ProcessInstanceId)
+	if err != nil {
+		return false, err
+	}
+	init, err := info.renderModuleTemplate(model.Module{Id: module.Id, ProcesInstanceId: meta.ProcessInstanceId, SmartServiceModuleInit: module.SmartServiceModuleInit}, meta, variables)
+	if err != nil {
+		return false, err
+	}
+	version, err := getModuleVersion(module.SmartServiceModuleInit)
+	if err != nil {
+		return false, err
+	}
+	newVersion, err := getModuleVersion(init)
+	if err != nil {
+		return false, err
+	}
+	if version == newVersion {
+		return false, nil
+	}
+	modules := []model.Module{{
+		Id:                     module.Id,
+		ProcesInstanceId:       meta.ProcessInstanceId,
+		SmartServiceModuleInit: init,
+	}}
+	event, err := getModuleUpdateEvent(model.CamundaExternalTask{Id: meta.Template.TaskId}, modules[0], module.SmartServiceModuleInit)
+	if err != nil {
+		return false, err
+	}
+	info.logModuleChanges([]ModuleEvent{event})
+	_, err = this.repo.SendCheckedModules(modules, nil, map[string]string{module.Id: version}, []ModuleEvent{event})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// POST /refresh refreshes all modules, POST /refresh/:id a single module
+func (this *Refresher) Endpoints(router *httprouter.Router) {
+	router.POST("/refresh", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		result, err := this.Refresh()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(result)
+	})
+	router.POST("/refresh/:id", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		changed, err := this.RefreshModule(params.ByName("id"))
+		if errors.Is(err, ErrModuleNotRefreshable) {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrConcurrentModification) {
+			http.Error(writer, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result := RefreshResult{}
+		if changed {
+			result.Refreshed = 1
+		} else {
+			result.Unchanged = 1
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(result)
+	})
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// resolves parent keys to module ids and moves siblings whose position collides with a module in modules
+// moved siblings that are not part of modules are appended to the result
+func (this *Info) resolveRelations(ctx context.Context, processInstanceId string, modules []model.Module, existing map[string]model.SmartServiceModuleInit) ([]model.Module, error) {
+	positioned := []int{}
+	for i := range modules {
+		meta, ok := getModuleMetadata(modules[i].ModuleData)
+		if !ok {
+			continue
+		}
+		if meta.ParentKey != "" {
+			parentId, err := this.getParentId(ctx, processInstanceId, meta.ParentKey, modules)
+			if err != nil {
+				return nil, err
+			}
+			if parentId == modules[i].Id {
+				return nil, fmt.Errorf("module %v may not be its own parent", modules[i].Id)
+			}
+			meta.ParentId = parentId
+			setModuleMetadata(modules[i].ModuleData, meta)
+		}
+		if meta.Position != nil {
+			positioned = append(positioned, i)
+		}
+	}
+	if len(positioned) == 0 {
+		return modules, nil
+	}
+	existingModules, err := this.repo(ctx).ListExistingModules(processInstanceId, model.ModulQuery{})
+	if err != nil {
+		this.libConfig.GetLogger().Error("error while getting existing modules", "error", err)
+		return nil, err
+	}
+	//modules are placed in order; a later module takes the position of a previously placed sibling
+	pending := map[int]bool{}
+	for _, i := range positioned {
+		pending[i] = true
+	}
+	for _, i := range positioned {
+		delete(pending, i)
+		modules, err = this.placeModule(processInstanceId, i, modules, existingModules, pending, existing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return modules, nil
+}
+
+// modules of the current task are preferred over already existing modules
+func (this *Info) getParentId(ctx context.Context, processInstanceId string, parentKey string, modules []model.Module) (parentId string, err error) {
+	for _, module := range modules {
+		if slices.Contains(module.Keys, parentKey) {
+			return module.Id, nil
+		}
+	}
+	parent, exists, err := this.getExistingModule(ctx, processInstanceId, parentKey)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("parent module with key %v not found", parentKey)
+	}
+	return parent.Id, nil
+}
+
+type sibling struct {
+	index    int //index in modules; -1 if the sibling is only known from existing modules
+	existing model.SmartServiceModule
+	meta     ModuleMetadata
+}
+
+// pending contains indexes of modules that are not yet placed and are therefore ignored as siblings
+func (this *Info) placeModule(processInstanceId string, index int, modules []model.Module, existingModules []model.SmartServiceModule, pending map[int]bool, existing map[string]model.SmartServiceModuleInit) ([]model.Module, error) {
+	meta, _ := getModuleMetadata(modules[index].ModuleData)
+	siblings := []sibling{}
+	ids := map[string]bool{}
+	for i, module := range modules {
+		ids[module.Id] = true
+		if i == index || pending[i] {
+			continue
+		}
+		if temp, ok := getModuleMetadata(module.ModuleData); ok && temp.Position != nil && temp.ParentId == meta.ParentId {
+			siblings = append(siblings, sibling{index: i, meta: temp})
+		}
+	}
+	for _, module := range existingModules {
+		if ids[module.Id] {
+			continue
+		}
+		if temp, ok := getModuleMetadata(module.ModuleData); ok && temp.Position != nil && temp.ParentId == meta.ParentId {
+			siblings = append(siblings, sibling{index: -1, existing: module, meta: temp})
+		}
+	}
+	sort.SliceStable(siblings, func(i, j int) bool {
+		return *siblings[i].meta.Position < *siblings[j].meta.Position
+	})
+	position := *meta.Position
+	for _, s := range siblings {
+		if *s.meta.Position < *meta.Position {
+			continue
+		}
+		if *s.meta.Position > position {
+			break
+		}
+		position = position + 1
+		newPosition := position
+		s.meta.Position = &newPosition
+		if s.index >= 0 {
+			setModuleMetadata(modules[s.index].ModuleData, s.meta)
+			continue
+		}
+		this.libConfig.GetLogger().Debug("move sibling module", "moduleId", s.existing.Id, "position", newPosition)
+		err := recordExistingModule(existing, s.existing.Id, s.existing.SmartServiceModuleInit)
+		if err != nil {
+			return nil, err
+		}
+		module := model.Module{
+			Id:                     s.existing.Id,
+			ProcesInstanceId:       processInstanceId,
+			SmartServiceModuleInit: s.existing.SmartServiceModuleInit,
+		}
+		setModuleMetadata(module.ModuleData, s.meta)
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+)
+
+// fields applied by Reloader.Reload; changes of other fields take effect after a restart
+var reloadableConfigFields = []string{
+	"worker_param_prefix",
+	"enable_additional_module_data_fields",
+	"allowed_module_types",
+	"required_module_data_fields",
+	"require_key",
+	"redacted_module_data_fields",
+	"profiles",
+	"module_scripts_dir",
+	"module_script_timeout",
+	"module_script_process_alloc_limit_mb",
+	"module_processors",
+	"module_data_templates_dir",
+	"module_data_templates_url",
+	"module_data_template_cache_duration",
+}
+
+var ErrReloaderNotStarted = errors.New("reloader is not connected to a started worker")
+
+// ConfigChange is a changed field of a reloaded config; Applied is false for fields that require a restart
+type ConfigChange struct {
+	Name    string      `json:"name"`
+	Old     interface{} `json:"old"`
+	New     interface{} `json:"new"`
+	Applied bool        `json:"applied"`
+}
+
+// Reloader reloads the config file and swaps the settings of the running profiles
+// tasks that are handled while reloading are finished with the previous settings
+type Reloader struct {
+	location  string
+	mux       sync.Mutex
+	config    Config
+	libConfig configuration.Config
+	apply     func(config Config)
+}
+
+// NewReloader reloads the config file at location; it is connected to the worker by WithReloader
+func NewReloader(location string) *Reloader {
+	return &Reloader{location: location}
+}
+
+func (this *Reloader) attach(config Config, libConfig configuration.Config, apply func(config Config)) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.config = config
+	this.libConfig = libConfig
+	this.apply = apply
+}
+
+// Reload loads the config file (and environment variables) and applies the reloadable fields
+// invalid configs and changes of the profile topics are rejected; the running settings are kept in this case
+func (this *Reloader) Reload() (changes []ConfigChange, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.apply == nil {
+		return nil, ErrReloaderNotStarted
+	}
+	logger := this.libConfig.GetLogger()
+	config, libConfig, err := LoadConfig(this.location)
+	if err == nil {
+		err = checkReloadedProfiles(this.config, config, this.libConfig)
+	}
+	if err != nil {
+		logger.Error("rejected config reload", "location", this.location, "error", err)
+		return nil, err
+	}
+	changes = getConfigChanges(GetConfigReport(this.config, this.libConfig), GetConfigReport(config, libConfig))
+	applied := []ConfigChange{}
+	restartRequired := []ConfigChange{}
+	for _, change := range changes {
+		if change.Applied {
+			applied = append(applied, change)
+		} else {
+			restartRequired = append(restartRequired, change)
+		}
+	}
+	if len(restartRequired) > 0 {
+		logger.Warn("config changes require a restart", "changes", restartRequired)
+	}
+	//applied even without changes, to read the current module scripts
+	this.config = getReloadedConfig(this.config, config)
+	this.apply(this.config)
+	logger.Info("reloaded config", "location", this.location, "applied", applied)
+	return changes, nil
+}
+
+// Watch calls Reload, when the content of the config file or of the module scripts changes; the files are checked every interval
+func (this *Reloader) Watch(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	hash, _ := this.getFileHash()
+	ticker := time.NewTicker(interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				newHash, err := this.getFileHash()
+				if err != nil || newHash == hash {
+					continue
+				}
+				hash = newHash
+				_, _ = this.Reload() //errors are logged by Reload
+			}
+		}
+	}()
+}
+
+// hashes the config file, the module scripts and the module data templates
+func (this *Reloader) getFileHash() (result [sha256.Size]byte, err error) {
+	this.mux.Lock()
+	files := []string{this.location}
+	patterns := []string{}
+	for _, dir := range []struct{ path, extension string }{
+		{this.config.ModuleScriptsDir, ModuleScriptExtension},
+		{this.config.ModuleDataTemplatesDir, ModuleDataTemplateExtension},
+	} {
+		if dir.path != "" && dir.path != "-" {
+			patterns = append(patterns, filepath.Join(dir.path, "*"+dir.extension))
+		}
+	}
+	this.mux.Unlock()
+	for _, pattern := range patterns {
+		dirFiles, err := filepath.Glob(pattern)
+		if err != nil {
+			return result, err
+		}
+		files = append(files, dirFiles...)
+	}
+	hash := sha256.New()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return result, err
+		}
+		hash.Write([]byte(file))
+		hash.Write(content)
+	}
+	copy(result[:], hash.Sum(nil))
+	return result, nil
+}
+
+// a fetch loop is started for each topic, so the topics of the profiles may not change without restart
+func checkReloadedProfiles(old Config, reloaded Config, libConfig configuration.Config) error {
+	err := reloaded.Validate()
+	if err != nil {
+		return err
+	}
+	oldTopics := []string{}
+	for _, profile := range GetProfiles(old, libConfig) {
+		oldTopics = append(oldTopics, profile.CamundaWorkerTopic)
+	}
+	reloadedTopics := []string{}
+	for _, profile := range GetProfiles(reloaded, libConfig) {
+		reloadedTopics = append(reloadedTopics, profile.CamundaWorkerTopic)
+	}
+	slices.Sort(oldTopics)
+	slices.Sort(reloadedTopics)
+	if !slices.Equal(oldTopics, reloadedTopics) {
+		return errors.New("the topics of the profiles may only be changed with a restart")
+	}
+	return nil
+}
+
+// returns old with the reloadable fields of reloaded
+func getReloadedConfig(old Config, reloaded Config) Config {
+	old.WorkerParamPrefix = reloaded.WorkerParamPrefix
+	old.EnableAdditionalModuleDataFields = reloaded.EnableAdditionalModuleDataFields
+	old.AllowedModuleTypes = reloaded.AllowedModuleTypes
+	old.RequiredModuleDataFields = reloaded.RequiredModuleDataFields
+	old.RequireKey = reloaded.RequireKey
+	old.RedactedModuleDataFields = reloaded.RedactedModuleDataFields
+	old.Profiles = reloaded.Profiles
+	old.ModuleScriptsDir = reloaded.ModuleScriptsDir
+	old.ModuleScriptTimeout = reloaded.ModuleScriptTimeout
+	old.ModuleScriptProcessAllocLimitMb = reloaded.ModuleScriptProcessAllocLimitMb
+	old.ModuleProcessors = reloaded.ModuleProcessors
+	old.ModuleDataTemplatesDir = reloaded.ModuleDataTemplatesDir
+	old.ModuleDataTemplatesUrl = reloaded.ModuleDataTemplatesUrl
+	old.ModuleDataTemplateCacheDuration = reloaded.ModuleDataTemplateCacheDuration
+	return old
+}
+
+func getConfigChanges(old []ConfigReportEntry, reloaded []ConfigReportEntry) (changes []ConfigChange) {
+	oldValues := map[string]interface{}{}
+	for _, entry := range old {
+		oldValues[entry.Name] = entry.Value
+	}
+	for _, entry := range reloaded {
+		oldValue := oldValues[entry.Name]
+		if reflect.DeepEqual(oldValue, entry.Value) {
+			continue
+		}
+		changes = append(changes, ConfigChange{
+			Name:    entry.Name,
+			Old:     oldValue,
+			New:     entry.Value,
+			Applied: slices.Contains(reloadableConfigFields, entry.Name),
+		})
+	}
+	return changes
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"slices"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// RenderUserId is the instance user of rendered tasks and the owner of existing modules without user_id
+const RenderUserId = "render-user"
+
+type RenderedModule struct {
+	Id string `json:"id"`
+	model.SmartServiceModuleInit
+}
+
+type RenderResult struct {
+	TaskId         string                 `json:"task_id"`
+	Modules        []RenderedModule       `json:"modules"`
+	DeletedModules []string               `json:"deleted_modules,omitempty"`
+	Outputs        map[string]interface{} `json:"outputs,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+}
+
+// Render handles the tasks with Info without access to camunda or the smart service repository
+// existing are the modules of the smart service repository before the first task; the modules of each task are applied to this state,
+// so that following tasks see the result of the previous tasks
+// variable references and scripts of the middleware are not applied
+func Render(config Config, libConfig configuration.Config, tasks []model.CamundaExternalTask, existing []model.SmartServiceModule) (results []RenderResult, ok bool) {
+	repo := &renderRepo{}
+	for _, module := range existing {
+		if module.UserId == "" {
+			module.UserId = RenderUserId
+		}
+		repo.modules = append(repo.modules, module)
+	}
+	handler := New(config, libConfig, repo, nil, nil)
+	ok = true
+	for _, task := range tasks {
+		repo.deleted = []string{}
+		result := RenderResult{TaskId: task.Id, Modules: []RenderedModule{}}
+		modules, outputs, err := handler.Do(task)
+		if err != nil {
+			result.Error = err.Error()
+			ok = false
+			results = append(results, result)
+			continue
+		}
+		for _, module := range modules {
+			result.Modules = append(result.Modules, RenderedModule{Id: module.Id, SmartServiceModuleInit: module.SmartServiceModuleInit})
+		}
+		result.Outputs = outputs
+		_, err = handler.writeModules(context.Background(), repo, modules, handler.takeWritePlan(task.Id))
+		result.DeletedModules = repo.deleted
+		if err != nil {
+			result.Error = err.Error()
+			ok = false
+		}
+		results = append(results, result)
+	}
+	return results, ok
+}
+
+// renderRepo is a SmartServiceRepo, storing modules in memory
+type renderRepo struct {
+	modules []model.SmartServiceModule
+	deleted []string
+}
+
+func (this *renderRepo) GetInstanceUser(instanceId string) (userId string, err error) {
+	return RenderUserId, nil
+}
+
+func (this *renderRepo) UseModuleDeleteInfo(info model.ModuleDeleteInfo) error {
+	return nil
+}
+
+func (this *renderRepo) ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	return this.ListModules(query)
+}
+
+func (this *renderRepo) ListModules(query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	result = []model.SmartServiceModule{}
+	for _, module := range this.modules {
+		if query.KeyFilter != nil && !slices.Contains(module.Keys, *query.KeyFilter) {
+			continue
+		}
+		if query.TypeFilter != nil && module.ModuleType != *query.TypeFilter {
+			continue
+		}
+		result = append(result, module)
+	}
+	if query.Offset > 0 {
+		result = result[min(query.Offset, int64(len(result))):]
+	}
+	if query.Limit > 0 {
+		result = result[:min(query.Limit, int64(len(result)))]
+	}
+	return result, nil
+}
+
+// all rendered modules belong to RenderUserId
+func (this *renderRepo) ListUserModules(userId string, query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	return this.ListModules(query)
+}
+
+// rendered modules are written without version check
+func (this *renderRepo) SendCheckedModules(modules []model.Module, deletes []model.Module, versions map[string]string, events []ModuleEvent) (result []model.SmartServiceModule, err error) {
+	err = this.write(modules)
+	if err != nil {
+		return result, err
+	}
+	for _, module := range deletes {
+		this.modules = slices.DeleteFunc(this.modules, func(existing model.SmartServiceModule) bool {
+			return existing.Id == module.Id
+		})
+		this.deleted = append(this.deleted, module.Id)
+	}
+	return result, nil
+}
+
+// stores the modules as the smart service repository would return them
+func (this *renderRepo) write(modules []model.Module) error {
+	for _, module := range modules {
+		stored := map[string]model.SmartServiceModuleInit{}
+		err := recordExistingModule(stored, module.Id, module.SmartServiceModuleInit)
+		if err != nil {
+			return err
+		}
+		entry := model.SmartServiceModule{
+			SmartServiceModuleBase: model.SmartServiceModuleBase{Id: module.Id, UserId: RenderUserId},
+			SmartServiceModuleInit: stored[module.Id],
+		}
+		index := slices.IndexFunc(this.modules, func(existing model.SmartServiceModule) bool {
+			return existing.Id == module.Id
+		})
+		if index >= 0 {
+			entry.SmartServiceModuleBase = this.modules[index].SmartServiceModuleBase
+			this.modules[index] = entry
+		} else {
+			this.modules = append(this.modules, entry)
+		}
+	}
+	return nil
+}
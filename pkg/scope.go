@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/SENERGY-Platform/service-commons/pkg/util"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const KeyScopeInstance = "instance"
+const KeyScopeUser = "user"
+
+// returns KeyScopeInstance if no key_scope is set
+func (this *Info) getKeyScope(task model.CamundaExternalTask) (scope string, err error) {
+	variable, ok := task.Variables[this.config.WorkerParamPrefix+"key_scope"]
+	if !ok || variable.Value == nil {
+		return KeyScopeInstance, nil
+	}
+	scope, ok = variable.Value.(string)
+	if !ok {
+		return "", errors.New("key_scope is not string")
+	}
+	return validateKeyScope(scope)
+}
+
+func validateKeyScope(scope string) (string, error) {
+	switch scope {
+	case "":
+		return KeyScopeInstance, nil
+	case KeyScopeInstance, KeyScopeUser:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown key_scope: %v", scope)
+	}
+}
+
+func (this *Info) getExistingModuleInScope(ctx context.Context, processInstanceId string, key string, scope string) (module model.Module, exists bool, err error) {
+	if scope == KeyScopeUser {
+		return this.getExistingUserModule(ctx, processInstanceId, key)
+	}
+	return this.getExistingModule(ctx, processInstanceId, key)
+}
+
+// searches the module with the given key in all instances of the user owning processInstanceId
+// the module is returned with processInstanceId, so that updates are sent through the current process instance;
+// the module may belong to another instance of the user, so deletes have to be checked with checkInstanceModule
+func (this *Info) getExistingUserModule(ctx context.Context, processInstanceId string, key string) (module model.Module, exists bool, err error) {
+	userId, err := this.repo(ctx).GetInstanceUser(processInstanceId)
+	if err != nil {
+		this.libConfig.GetLogger().Error("error while getting instance user", "error", err)
+		return module, false, err
+	}
+	if userId == "" {
+		return module, false, fmt.Errorf("unable to find user of process instance %v", processInstanceId)
+	}
+	//the modules are listed with the token of the user, so that only modules of this user are returned;
+	//the user id is checked nevertheless, in case the repository returns the modules of other users to privileged tokens
+	existingModules := []model.SmartServiceModule{}
+	for candidate, err := range util.IterBatch(100, func(limit int64, offset int64) ([]model.SmartServiceModule, error) {
+		return this.repo(ctx).ListUserModules(userId, model.ModulQuery{KeyFilter: &key, Limit: limit, Offset: offset})
+	}) {
+		if err != nil {
+			this.libConfig.GetLogger().Error("error while getting existing user modules", "error", err)
+			return module, false, err
+		}
+		if candidate.UserId == userId {
+			existingModules = append(existingModules, candidate)
+		}
+	}
+	this.libConfig.GetLogger().Debug("existing user module request", "processInstanceId", processInstanceId, "userId", userId, "key", key, "existingModules", existingModules)
+	if len(existingModules) == 0 {
+		return module, false, nil
+	}
+	latest := existingModules[0]
+	if len(existingModules) > 1 {
+		this.libConfig.GetLogger().Warn("more than one existing user module found", "userId", userId, "key", key, "existingModules", existingModules)
+		for _, existing := range existingModules {
+			if existing.LastUpdate > latest.LastUpdate {
+				latest = existing
+			}
+		}
+	}
+	module.SmartServiceModuleInit = latest.SmartServiceModuleInit
+	module.ProcesInstanceId = processInstanceId
+	module.Id = latest.Id
+	return module, true, nil
+}
+
+// modules are deleted through the process instance owning them
+func (this *Info) checkInstanceModule(ctx context.Context, processInstanceId string, key string, module model.Module) error {
+	owned, err := isProcessInstanceModule(this.repo(ctx), processInstanceId, module.Id, model.ModulQuery{KeyFilter: &key})
+	if err != nil {
+		this.libConfig.GetLogger().Error("error while getting existing modules", "error", err)
+		return err
+	}
+	if !owned {
+		return fmt.Errorf("module %v with key %v belongs to another smart service instance and can not be deleted by process instance %v", module.Id, key, processInstanceId)
+	}
+	return nil
+}
+
+type processInstanceModuleLister interface {
+	ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error)
+}
+
+// the module record contains only the smart service instance of the module, so the process instance owning a module
+// is confirmed by the modules the repository lists for the process instance; query narrows the list (e.g. by key or type)
+// the list of a process instance is not paginated by the lib client
+func isProcessInstanceModule(repo processInstanceModuleLister, processInstanceId string, moduleId string, query model.ModulQuery) (bool, error) {
+	modules, err := repo.ListExistingModules(processInstanceId, query)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(modules, func(module model.SmartServiceModule) bool {
+		return module.Id == moduleId
+	}), nil
+}
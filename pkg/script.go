@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/dop251/goja"
+)
+
+const ModuleScriptExtension = ".js"
+const ModuleScriptFunction = "transform"
+const moduleScriptDefaultTimeout = time.Second
+const moduleScriptMaxCallStackSize = 1024
+const moduleScriptCheckInterval = 10 * time.Millisecond
+
+var ErrModuleScriptTimeout = errors.New("module script timeout")
+var ErrModuleScriptProcessAllocLimit = errors.New("process allocations exceeded module_script_process_alloc_limit_mb while the module script ran")
+
+// loadModuleScripts compiles the scripts <module_type>.js of dir; an empty dir disables module scripts
+func loadModuleScripts(dir string) (result map[string]*goja.Program, err error) {
+	result = map[string]*goja.Program{}
+	if dir == "" || dir == "-" {
+		return result, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+ModuleScriptExtension))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		program, err := goja.Compile(file, string(source), true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module script: %w", err)
+		}
+		result[strings.TrimSuffix(filepath.Base(file), ModuleScriptExtension)] = program
+	}
+	return result, nil
+}
+
+// moduleScripts loads the scripts of dir on first use, so that each Info reads the current files
+type moduleScripts struct {
+	dir      string
+	once     sync.Once
+	programs map[string]*goja.Program
+	err      error
+}
+
+func newModuleScripts(dir string) *moduleScripts {
+	return &moduleScripts{dir: dir}
+}
+
+func (this *moduleScripts) get(moduleType string) (program *goja.Program, err error) {
+	this.once.Do(func() {
+		this.programs, this.err = loadModuleScripts(this.dir)
+	})
+	return this.programs[moduleType], this.err
+}
+
+// script processor: passes the module data to the script of the module type, which returns the final module data
+// the module metadata can not be changed by scripts
+func (this *Info) transformModule(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error {
+	program, err := this.scripts.get(init.ModuleType)
+	if err != nil || program == nil || init.ModuleData == nil {
+		return err
+	}
+	variables := map[string]interface{}{}
+	for key, variable := range task.Variables {
+		variables[key] = variable.Value
+	}
+	var existingData map[string]interface{}
+	if existing != nil {
+		existingData = existing.ModuleData
+	}
+	data, err := this.runModuleScript(program, init.ModuleData, variables, existingData)
+	if err != nil {
+		return fmt.Errorf("module script %v: %w", init.ModuleType, err)
+	}
+	if meta, ok := init.ModuleData[ModuleMetadataField]; ok {
+		data[ModuleMetadataField] = meta
+	} else {
+		delete(data, ModuleMetadataField)
+	}
+	init.ModuleData = data
+	return nil
+}
+
+// runs the transform function of program with copies of the arguments
+// the script is interrupted after module_script_timeout or when the process allocates more than module_script_process_alloc_limit_mb while it runs
+func (this *Info) runModuleScript(program *goja.Program, data map[string]interface{}, variables map[string]interface{}, existing map[string]interface{}) (result map[string]interface{}, err error) {
+	args := []interface{}{}
+	for _, arg := range []map[string]interface{}{data, variables, existing} {
+		if arg == nil {
+			args = append(args, nil)
+			continue
+		}
+		arg, err = normalizeModuleData(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	vm := goja.New()
+	vm.SetMaxCallStackSize(moduleScriptMaxCallStackSize)
+	done := make(chan struct{})
+	defer close(done)
+	go watchModuleScript(vm, this.getModuleScriptTimeout(), uint64(this.config.ModuleScriptProcessAllocLimitMb)*1024*1024, done)
+	_, err = vm.RunProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	transform, ok := goja.AssertFunction(vm.Get(ModuleScriptFunction))
+	if !ok {
+		return nil, fmt.Errorf("missing function %v", ModuleScriptFunction)
+	}
+	value, err := transform(goja.Undefined(), vm.ToValue(args[0]), vm.ToValue(args[1]), vm.ToValue(args[2]))
+	if err != nil {
+		return nil, err
+	}
+	result, ok = value.Export().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must return an object", ModuleScriptFunction)
+	}
+	return normalizeModuleData(result)
+}
+
+func (this *Info) getModuleScriptTimeout() time.Duration {
+	timeout, err := time.ParseDuration(this.config.ModuleScriptTimeout)
+	if err != nil || timeout <= 0 {
+		return moduleScriptDefaultTimeout
+	}
+	return timeout
+}
+
+// goja can not measure the allocations of a runtime, so the cumulative allocations of the whole process are checked instead
+// this is not a limit of the script: allocations of other goroutines (other tasks, kafka, tracing, the api) are counted as well
+func watchModuleScript(vm *goja.Runtime, timeout time.Duration, allocLimit uint64, done chan struct{}) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(moduleScriptCheckInterval)
+	defer ticker.Stop()
+	start := getAllocatedBytes()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+			vm.Interrupt(ErrModuleScriptTimeout)
+			return
+		case <-ticker.C:
+			if allocLimit > 0 && getAllocatedBytes()-start > allocLimit {
+				vm.Interrupt(ErrModuleScriptProcessAllocLimit)
+				return
+			}
+		}
+	}
+}
+
+func getAllocatedBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
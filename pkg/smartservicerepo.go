@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/smartservicerepository"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrModuleNotFound = errors.New("module not found")
+
+// SmartServiceRepository adds the calls needed by the info worker to the lib repository client
+type SmartServiceRepository struct {
+	*smartservicerepository.SmartServiceRepository
+	libConfig configuration.Config
+	auth      Auth
+	producer  ModuleEventProducer
+	history   HistoryStore
+	metrics   *Metrics
+	tracing   *Tracing
+	auditSink AuditSink
+	ctx       context.Context //parent of the request spans; set by WithContext
+
+	checkedWritesMux *sync.Mutex //serializes the checked writes of this repository (e.g. of a worker and the refresher); shared by the copies of WithContext
+}
+
+type Auth interface {
+	Ensure() (token auth.Token, err error)
+	ExchangeUserToken(userid string) (token auth.Token, err error)
+}
+
+// producer, history, metrics, tracing and auditSink may be nil, to disable module events, the revision history, metrics, tracing and the audit log
+func NewSmartServiceRepository(libConfig configuration.Config, auth Auth, repo *smartservicerepository.SmartServiceRepository, producer ModuleEventProducer, history HistoryStore, metrics *Metrics, tracing *Tracing, auditSink AuditSink) *SmartServiceRepository {
+	return &SmartServiceRepository{
+		SmartServiceRepository: repo,
+		libConfig:              libConfig,
+		auth:                   auth,
+		producer:               producer,
+		history:                history,
+		metrics:                metrics,
+		tracing:                tracing,
+		auditSink:              auditSink,
+		checkedWritesMux:       &sync.Mutex{},
+	}
+}
+
+// WithContext returns a copy of the repository, whose requests are traced as children of the span of ctx
+func (this *SmartServiceRepository) WithContext(ctx context.Context) *SmartServiceRepository {
+	result := *this
+	result.ctx = ctx
+	return &result
+}
+
+// observe starts a span for the repository request; the returned func ends the span and records the request duration
+func (this *SmartServiceRepository) observe(operation string, processInstanceId string, attributes ...attribute.KeyValue) func(err error) {
+	start := time.Now()
+	_, _, end := this.tracing.start(this.ctx, processInstanceId, "smart_service_repository."+operation, attributes...)
+	return func(err error) {
+		this.metrics.observeRepositoryRequest(operation, start, err)
+		end(err)
+	}
+}
+
+func (this *SmartServiceRepository) GetInstanceUser(instanceId string) (userId string, err error) {
+	done := this.observe("get_instance_user", instanceId)
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.GetInstanceUser(instanceId)
+}
+
+func (this *SmartServiceRepository) GetVariables(processId string) (result map[string]interface{}, err error) {
+	done := this.observe("get_variables", processId)
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.GetVariables(processId)
+}
+
+func (this *SmartServiceRepository) SetVariables(processId string, changes map[string]interface{}) (err error) {
+	done := this.observe("set_variables", processId)
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.SetVariables(processId, changes)
+}
+
+func (this *SmartServiceRepository) UseModuleDeleteInfo(info model.ModuleDeleteInfo) (err error) {
+	done := this.observe("use_module_delete_info", "")
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.UseModuleDeleteInfo(info)
+}
+
+func (this *SmartServiceRepository) SendWorkerError(task model.CamundaExternalTask, errMsg error) (err error) {
+	done := this.observe("send_worker_error", task.ProcessInstanceId, attribute.String("task_id", task.Id))
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.SendWorkerError(task, errMsg)
+}
+
+func (this *SmartServiceRepository) SetSmartServiceModuleError(moduleId string, errMsg error) (err error) {
+	done := this.observe("set_module_error", "", attribute.String("module_id", moduleId))
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.SetSmartServiceModuleError(moduleId, errMsg)
+}
+
+func (this *SmartServiceRepository) ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	done := this.observe("list_existing_modules", processInstanceId)
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.ListExistingModules(processInstanceId, query)
+}
+
+func (this *SmartServiceRepository) ListModules(query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	done := this.observe("list_modules", "")
+	defer func() { done(err) }()
+	return this.SmartServiceRepository.ListModules(query)
+}
+
+// ListUserModules lists the modules visible to the user, by calling GET /modules with a token of the user instead of the worker token
+func (this *SmartServiceRepository) ListUserModules(userId string, query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	done := this.observe("list_user_modules", "")
+	defer func() { done(err) }()
+	queryValues := url.Values{}
+	if query.KeyFilter != nil {
+		queryValues.Set("key", *query.KeyFilter)
+	}
+	if query.TypeFilter != nil {
+		queryValues.Set("module_type", *query.TypeFilter)
+	}
+	if query.Limit > 0 {
+		queryValues.Set("limit", strconv.FormatInt(query.Limit, 10))
+	}
+	if query.Offset > 0 {
+		queryValues.Set("offset", strconv.FormatInt(query.Offset, 10))
+	}
+	queryStr := ""
+	if len(queryValues) > 0 {
+		queryStr = "?" + queryValues.Encode()
+	}
+	req, err := http.NewRequest("GET", this.libConfig.SmartServiceRepositoryUrl+"/modules"+queryStr, nil)
+	if err != nil {
+		return result, err
+	}
+	token, err := this.auth.ExchangeUserToken(userId)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Authorization", token.Jwt())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		temp, _ := io.ReadAll(resp.Body)
+		return result, errors.New(string(temp))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+func (this *SmartServiceRepository) GetModule(userId string, moduleId string) (result model.SmartServiceModule, err error, code int) {
+	done := this.observe("get_module", "", attribute.String("module_id", moduleId))
+	result, err, code = this.SmartServiceRepository.GetModule(userId, moduleId)
+	requestErr := err
+	if code == http.StatusNotFound {
+		requestErr = nil //expected for removed modules; not counted as repository error
+	}
+	done(requestErr)
+	return result, err, code
+}
+
+// DeleteModule removes the module with DELETE /instances-by-process-id/{id}/modules/{moduleId} of the smart-service-repository api,
+// the counterpart of the PUT the lib writes modules with; the lib client has no method for this endpoint
+// processInstanceId must be the process instance owning the module (see Info.checkInstanceModule);
+// a 404 is returned as ErrModuleNotFound, because the module has not been removed through this process instance
+func (this *SmartServiceRepository) DeleteModule(processInstanceId string, moduleId string) (err error) {
+	done := this.observe("delete_module", processInstanceId, attribute.String("module_id", moduleId))
+	defer func() { done(err) }()
+	req, err := http.NewRequest("DELETE", this.libConfig.SmartServiceRepositoryUrl+"/instances-by-process-id/"+url.PathEscape(processInstanceId)+"/modules/"+url.PathEscape(moduleId), nil)
+	if err != nil {
+		return err
+	}
+	token, err := this.auth.Ensure()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", token.Jwt())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		_, _ = io.ReadAll(resp.Body)
+		err = fmt.Errorf("%w: module %v in process instance %v", ErrModuleNotFound, moduleId, processInstanceId)
+		this.libConfig.GetLogger().Error("error in SmartServiceRepository.DeleteModule", "error", err, "moduleId", moduleId)
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		temp, _ := io.ReadAll(resp.Body)
+		err = errors.New(string(temp))
+		this.libConfig.GetLogger().Error("error in SmartServiceRepository.DeleteModule", "error", err, "moduleId", moduleId)
+		return err
+	}
+	_, _ = io.ReadAll(resp.Body)
+	return nil
+}
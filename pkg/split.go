@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// ModuleDataPart is an input parameter of a task, containing a part of module_data
+type ModuleDataPart struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SplitModuleData splits moduleData into input parameters of at most maxLength bytes,
+// which are joined to moduleData by the worker (see Info.getJoinedVariable)
+// if moduleData fits into one parameter, the parameter is named prefix+"module_data"; otherwise the parts are numbered with equal width,
+// so that the lexicographic order of the names equals the order of the parts
+// parts are never split inside of utf-8 characters, expressions (${...}) or variable references ({{...}}), because they are evaluated per parameter,
+// and never next to whitespace, which may be trimmed by bpmn tools
+func SplitModuleData(prefix string, moduleData string, maxLength int) (parts []ModuleDataPart, err error) {
+	if maxLength < 1 {
+		return nil, errors.New("max length must be positive")
+	}
+	temp := map[string]interface{}{}
+	err = json.Unmarshal([]byte(expressionPattern.ReplaceAllString(moduleData, expressionPlaceholder)), &temp)
+	if err != nil {
+		return nil, fmt.Errorf("module_data is no json object: %w", err)
+	}
+	if len(moduleData) <= maxLength {
+		return []ModuleDataPart{{Name: prefix + "module_data", Value: moduleData}}, nil
+	}
+	expressions := expressionPattern.FindAllStringIndex(moduleData, -1)
+	values := []string{}
+	for start := 0; start < len(moduleData); {
+		end, ok := findModuleDataSplitPosition(moduleData, start, maxLength, expressions)
+		if !ok {
+			return nil, fmt.Errorf("unable to split module_data at position %v into parts of %v bytes", start, maxLength)
+		}
+		values = append(values, moduleData[start:end])
+		start = end
+	}
+	width := len(strconv.Itoa(len(values)))
+	for i, value := range values {
+		parts = append(parts, ModuleDataPart{Name: fmt.Sprintf("%vmodule_data_%0*d", prefix, width, i+1), Value: value})
+	}
+	return parts, nil
+}
+
+// returns the largest end of a part beginning at start
+func findModuleDataSplitPosition(moduleData string, start int, maxLength int, expressions [][]int) (end int, ok bool) {
+	if start+maxLength >= len(moduleData) {
+		return len(moduleData), true
+	}
+	for end = start + maxLength; end > start; end-- {
+		if !utf8.RuneStart(moduleData[end]) || unicode.IsSpace(rune(moduleData[end-1])) || unicode.IsSpace(rune(moduleData[end])) {
+			continue
+		}
+		inExpression := false
+		for _, expression := range expressions {
+			if expression[0] < end && end < expression[1] {
+				inExpression = true
+			}
+		}
+		if !inExpression {
+			return end, true
+		}
+	}
+	return 0, false
+}
+
+// ModuleDataPartsToVariables returns the parts in the format of camunda task variables
+func ModuleDataPartsToVariables(parts []ModuleDataPart) map[string]model.CamundaVariable {
+	result := map[string]model.CamundaVariable{}
+	for _, part := range parts {
+		result[part.Name] = model.CamundaVariable{Value: part.Value}
+	}
+	return result
+}
+
+// quotes are kept in element text, to keep the json readable
+var bpmnTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+// ModuleDataPartsToBpmn returns the parts as camunda:inputParameter elements
+func ModuleDataPartsToBpmn(parts []ModuleDataPart) (string, error) {
+	buf := bytes.Buffer{}
+	for _, part := range parts {
+		buf.WriteString(`<camunda:inputParameter name="`)
+		err := xml.EscapeText(&buf, []byte(part.Name))
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(`">`)
+		buf.WriteString(bpmnTextEscaper.Replace(part.Value))
+		buf.WriteString("</camunda:inputParameter>\n")
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ModuleDataRefVariable = "module_data_ref"
+const ModuleDataTemplateExtension = ".json"
+const moduleDataTemplateDefaultCacheDuration = 5 * time.Minute
+
+var ErrModuleDataTemplateNotFound = errors.New("module data template not found")
+var ErrModuleDataTemplatesNotConfigured = errors.New("neither module_data_templates_dir nor module_data_templates_url is set")
+
+// names and versions of module_data_ref; no path separators and no leading dot
+var moduleDataRefPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+var moduleDataTemplateClient = &http.Client{Timeout: 5 * time.Second}
+
+// parseModuleDataRef splits ref (name or name@version) into name and version; version is empty for unversioned references
+func parseModuleDataRef(ref string) (name string, version string, err error) {
+	name, version, versioned := strings.Cut(ref, "@")
+	if !moduleDataRefPattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid module_data_ref name: %q", ref)
+	}
+	if versioned && !moduleDataRefPattern.MatchString(version) {
+		return "", "", fmt.Errorf("invalid module_data_ref version: %q", ref)
+	}
+	return name, version, nil
+}
+
+func validateModuleDataRef(ref string) (string, error) {
+	_, _, err := parseModuleDataRef(ref)
+	return ref, err
+}
+
+// moduleDataTemplates loads the templates referenced by module_data_ref from a local directory or an HTTP template store
+// versioned templates are cached for the lifetime of the Info (until the next reload), unversioned templates for cacheDuration
+type moduleDataTemplates struct {
+	dir           string
+	url           string
+	cacheDuration time.Duration
+	mux           sync.Mutex
+	cache         map[string]moduleDataTemplateCacheEntry
+}
+
+type moduleDataTemplateCacheEntry struct {
+	raw    []byte
+	loaded time.Time
+}
+
+func newModuleDataTemplates(config Config) *moduleDataTemplates {
+	result := &moduleDataTemplates{
+		cacheDuration: moduleDataTemplateDefaultCacheDuration,
+		cache:         map[string]moduleDataTemplateCacheEntry{},
+	}
+	if config.ModuleDataTemplatesDir != "-" {
+		result.dir = config.ModuleDataTemplatesDir
+	}
+	if config.ModuleDataTemplatesUrl != "-" {
+		result.url = strings.TrimSuffix(config.ModuleDataTemplatesUrl, "/")
+	}
+	if config.ModuleDataTemplateCacheDuration == "-" {
+		result.cacheDuration = 0
+	} else if duration, err := time.ParseDuration(config.ModuleDataTemplateCacheDuration); err == nil {
+		result.cacheDuration = duration
+	}
+	return result
+}
+
+// get returns a new copy of the referenced template for each call
+func (this *moduleDataTemplates) get(ref string) (result map[string]interface{}, err error) {
+	name, version, err := parseModuleDataRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	this.mux.Lock()
+	entry, ok := this.cache[ref]
+	this.mux.Unlock()
+	if !ok || (version == "" && time.Since(entry.loaded) >= this.cacheDuration) {
+		entry.raw, err = this.load(name, version)
+		if err != nil {
+			return nil, fmt.Errorf("module_data_ref %v: %w", ref, err)
+		}
+		entry.loaded = time.Now()
+		this.mux.Lock()
+		this.cache[ref] = entry
+		this.mux.Unlock()
+	}
+	err = json.Unmarshal(entry.raw, &result)
+	return result, err
+}
+
+// load reads <dir>/<name>[@<version>].json or, if the file does not exist, GET <url>/<name>[@<version>]
+func (this *moduleDataTemplates) load(name string, version string) (raw []byte, err error) {
+	file := name
+	if version != "" {
+		file = name + "@" + version
+	}
+	if this.dir == "" && this.url == "" {
+		return nil, ErrModuleDataTemplatesNotConfigured
+	}
+	err = ErrModuleDataTemplateNotFound
+	if this.dir != "" {
+		raw, err = os.ReadFile(filepath.Join(this.dir, file+ModuleDataTemplateExtension))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			err = ErrModuleDataTemplateNotFound
+		}
+	}
+	if err != nil && this.url != "" {
+		raw, err = this.fetch(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	temp := map[string]interface{}{}
+	err = json.Unmarshal(raw, &temp)
+	if err != nil {
+		return nil, fmt.Errorf("template is no json object: %w", err)
+	}
+	return raw, nil
+}
+
+func (this *moduleDataTemplates) fetch(file string) (raw []byte, err error) {
+	resp, err := moduleDataTemplateClient.Get(this.url + "/" + url.PathEscape(file))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrModuleDataTemplateNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected template store response: " + resp.Status + " " + string(raw))
+	}
+	return raw, nil
+}
+
+// reports whether the variable key is a part of the joined variable name (both with WorkerParamPrefix)
+// <name>_ref (e.g. module_data_ref) references a template and is no part of <name>
+func isJoinedVariablePart(key string, name string) bool {
+	return strings.HasPrefix(key, name) && key != name+"_ref"
+}
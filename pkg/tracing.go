@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TracerName = "github.com/SENERGY-Platform/smart-service-module-worker-info"
+
+const TracingExporterStdout = "stdout"
+const TracingExporterOtlp = "otlp"
+
+// NewTracerProvider creates a tracer provider for config.TracingExporter, which is shut down when ctx is done
+// returns nil if tracing is disabled
+func NewTracerProvider(ctx context.Context, wg *sync.WaitGroup, config Config, libConfig configuration.Config) (provider trace.TracerProvider, err error) {
+	var exporter sdktrace.SpanExporter
+	switch config.TracingExporter {
+	case "", "-":
+		return nil, nil
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New()
+	case TracingExporterOtlp:
+		options := []otlptracehttp.Option{}
+		if config.OtlpEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.OtlpEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing_exporter %v", config.TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sdkProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "smart-service-module-worker-"+libConfig.CamundaWorkerTopic))),
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		err := sdkProvider.Shutdown(context.Background())
+		if err != nil {
+			libConfig.GetLogger().Error("unable to shutdown tracer provider", "error", err)
+		}
+	}()
+	return sdkProvider, nil
+}
+
+// Tracing creates the spans of task handling and repository calls
+// the parent of a span is the span of the context it is started with; the handler and repository interfaces of the lib carry no context,
+// so the middleware of a task is created with a repository bound to the context of the task (see SmartServiceRepository.WithContext)
+// a nil Tracing creates no spans
+type Tracing struct {
+	tracer trace.Tracer
+}
+
+// returns nil if provider is nil
+func NewTracing(provider trace.TracerProvider) *Tracing {
+	if provider == nil {
+		return nil
+	}
+	return &Tracing{tracer: provider.Tracer(TracerName)}
+}
+
+// start starts a span as child of the span of ctx; the returned context carries the new span as parent for the spans of the call
+func (this *Tracing) start(ctx context.Context, processInstanceId string, name string, attributes ...attribute.KeyValue) (spanCtx context.Context, span trace.Span, end func(err error)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if this == nil {
+		return ctx, trace.SpanFromContext(ctx), func(error) {}
+	}
+	if processInstanceId != "" {
+		attributes = append(attributes, attribute.String("process_instance_id", processInstanceId))
+	}
+	spanCtx, span = this.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+	return spanCtx, span, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (this *Tracing) startTask(ctx context.Context, name string, task model.CamundaExternalTask) (spanCtx context.Context, span trace.Span, end func(err error)) {
+	return this.start(ctx, task.ProcessInstanceId, name, attribute.String("task_id", task.Id))
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// render handles the tasks of a camunda task file offline and prints the resulting modules
+// usage: info render [--config config.json] [--topic info] [--existing modules.json] task.json
+// returns the exit code: 0 on success, 1 if a task failed, 2 on invalid usage
+func render(args []string) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	configLocation := flags.String("config", "config.json", "configuration file")
+	topic := flags.String("topic", "", "camunda topic of the profile used to handle the tasks (default first profile)")
+	existingLocation := flags.String("existing", "", "json list of modules, that exist before the first task (same format as the smart service repository module list)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: info render [--config config.json] [--topic info] [--existing modules.json] task.json")
+		fmt.Fprintln(flags.Output(), "task.json contains a camunda task or a list of camunda tasks (like test/testcases/*/camunda_tasks.json)")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	//the lib logger writes to os.Stdout, which is reserved for the result
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	config, libConfig, err := pkg.LoadConfig(*configLocation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	profile, err := pkg.GetProfile(config, libConfig, *topic)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	config, libConfig = profile.Apply(config, libConfig)
+	tasks, err := readRenderTasks(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unable to read tasks:", err)
+		return 2
+	}
+	existing := []model.SmartServiceModule{}
+	if *existingLocation != "" {
+		err = readJsonFile(*existingLocation, &existing)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "unable to read existing modules:", err)
+			return 2
+		}
+	}
+
+	results, ok := pkg.Render(config, libConfig, tasks, existing)
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	err = encoder.Encode(results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// the file may contain a single task or a list of tasks
+func readRenderTasks(location string) (tasks []model.CamundaExternalTask, err error) {
+	temp, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(temp, &tasks)
+	if err == nil {
+		return tasks, nil
+	}
+	task := model.CamundaExternalTask{}
+	if json.Unmarshal(temp, &task) != nil {
+		return nil, err
+	}
+	return []model.CamundaExternalTask{task}, nil
+}
+
+func readJsonFile(location string, result interface{}) error {
+	temp, err := os.ReadFile(location)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(temp, result)
+}
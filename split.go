@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+)
+
+// split prints the module_data input parameters for a widget json file
+// usage: info split [--config config.json] [--max-length 4000] [--format json|xml] [--compact=false] widget.json
+// returns the exit code: 0 on success, 1 if the file can not be split, 2 on invalid usage
+func split(args []string) int {
+	flags := flag.NewFlagSet("split", flag.ContinueOnError)
+	configLocation := flags.String("config", "config.json", "configuration file")
+	maxLength := flags.Int("max-length", 4000, "maximal length of a parameter value in bytes")
+	format := flags.String("format", "json", "output format: json (camunda task variables) or xml (camunda:inputParameter elements)")
+	compact := flags.Bool("compact", true, "remove insignificant whitespace from valid json before splitting")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: info split [--config config.json] [--max-length 4000] [--format json|xml] [--compact=false] widget.json")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*format != "json" && *format != "xml") {
+		flags.Usage()
+		return 2
+	}
+
+	//the lib logger writes to os.Stdout, which is reserved for the result
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	config, _, err := pkg.LoadConfig(*configLocation)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	moduleData, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	moduleData = bytes.TrimSpace(moduleData)
+	if *compact {
+		buf := bytes.Buffer{}
+		//files with variable references or expressions may be invalid json and are used as is
+		if json.Compact(&buf, moduleData) == nil {
+			moduleData = buf.Bytes()
+		}
+	}
+
+	parts, err := pkg.SplitModuleData(config.WorkerParamPrefix, string(moduleData), *maxLength)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *format == "xml" {
+		result, err := pkg.ModuleDataPartsToBpmn(parts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprint(out, result)
+		return 0
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(pkg.ModuleDataPartsToVariables(parts))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestAuditLog(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.AuditLog = filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tasks := []map[string]model.CamundaVariable{
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"bar"}`}},
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"bar"}`}},
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"baz"}`}},
+		{"info.key": {Value: "42"}, "info.mode": {Value: "delete"}},
+	}
+	for i, variables := range tasks {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                "task" + strconv.Itoa(i+1),
+			ProcessInstanceId: "process-instance-1",
+			Variables:         variables,
+		}})
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	entries, err := readAuditLog(conf.AuditLog)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(entries) != len(tasks) {
+		t.Errorf("%#v", entries)
+		return
+	}
+	for i, action := range []string{pkg.ModuleCreated, pkg.ModuleUnchanged, pkg.ModuleUpdated, pkg.ModuleDeleted} {
+		entry := entries[i]
+		if entry.Time.IsZero() || entry.Hash == "" {
+			t.Errorf("missing time or hash %#v", entry)
+		}
+		expected := pkg.AuditEntry{
+			Time:              entry.Time,
+			ProcessInstanceId: "process-instance-1",
+			TaskId:            "task" + strconv.Itoa(i+1),
+			UserId:            "ebbad927-4c39-4d12-8690-89b067dd4ce7",
+			ModuleId:          "process-instance-1.task1",
+			Keys:              []string{"42"},
+			ModuleType:        "info",
+			Action:            action,
+			Hash:              entry.Hash,
+		}
+		if !reflect.DeepEqual(entry, expected) {
+			t.Errorf("\n%#v\n%#v", entry, expected)
+		}
+	}
+	if entries[0].Hash != entries[1].Hash {
+		t.Error("expected same hash for unchanged module")
+	}
+	if entries[1].Hash == entries[2].Hash {
+		t.Error("expected different hash for updated module")
+	}
+	if entries[2].Hash != entries[3].Hash {
+		t.Error("expected hash of the deleted module state")
+	}
+}
+
+func readAuditLog(path string) (result []pkg.AuditEntry, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := pkg.AuditEntry{}
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/smartservicerepository"
+)
+
+func TestConcurrentKeyedUpdates(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	for _, value := range []string{"a", "b"} {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                "task-" + value,
+			ProcessInstanceId: "process-instance-1",
+			Variables: map[string]model.CamundaVariable{
+				"info.key":         {Value: "42"},
+				"info.module_data": {Value: `{"foo":"` + value + `"}`},
+			},
+		}})
+	}
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[{"id":"module-1","module_type":"info","module_data":{"foo":"initial"},"keys":["42"]}]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	//both workers (like two replicas without a shared lock) read and check the module before one of them may write it,
+	//and both writes are stored before either worker reads the module again
+	smartServiceRepo.SetModuleListBarrier(2)
+	smartServiceRepo.SetModuleWriteBarrier(2)
+
+	for i := 0; i < 2; i++ {
+		err = pkg.Start(ctx, wg, conf, libConf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	time.Sleep(2 * time.Second)
+
+	writes := 0
+	for _, request := range smartServiceRepo.GetRequestLog() {
+		if request.Method == "PUT" && strings.HasSuffix(request.Endpoint, "/modules/module-1") {
+			writes++
+		}
+	}
+	if writes < 3 {
+		t.Error("expected the overwritten write to be repeated, got writes:", writes)
+	}
+
+	//the worker whose write has been overwritten handles its task again with the current module, without waiting for the lock duration
+	completed := []string{}
+	for _, request := range camunda.PopRequestLog() {
+		if strings.HasSuffix(request.Endpoint, "/complete") {
+			completed = append(completed, strings.TrimSuffix(strings.TrimPrefix(request.Endpoint, "/engine-rest/external-task/"), "/complete"))
+		}
+		if strings.HasSuffix(request.Endpoint, "/error") {
+			t.Error("unexpected error", request)
+		}
+	}
+	if len(completed) != 2 {
+		t.Error("expected two completed tasks, got", completed)
+		return
+	}
+
+	modules := smartServiceRepo.GetModules()
+	if len(modules) != 1 {
+		t.Error(modules)
+		return
+	}
+	if foo := modules[0].ModuleData["foo"]; foo != "a" && foo != "b" {
+		t.Error(modules[0].ModuleData)
+	}
+}
+
+// modules with an outdated version are not written
+func TestSendCheckedModules(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[{"id":"module-1","module_type":"info","module_data":{"foo":"initial"},"keys":["42"]}]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	authentication := auth.New(libConf)
+	repo := pkg.NewSmartServiceRepository(libConf, authentication, smartservicerepository.New(libConf, authentication), nil, nil, nil, nil, nil)
+	modules := []model.Module{{
+		Id:                     "module-1",
+		ProcesInstanceId:       "process-instance-1",
+		SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"foo": "new"}, Keys: []string{"42"}},
+	}}
+
+	_, err = repo.SendCheckedModules(modules, nil, map[string]string{"module-1": "outdated"}, nil)
+	if !errors.Is(err, pkg.ErrConcurrentModification) {
+		t.Error(err)
+		return
+	}
+	if stored := smartServiceRepo.GetModules(); len(stored) != 1 || stored[0].ModuleData["foo"] != "initial" {
+		t.Error(stored)
+	}
+
+	_, err = repo.SendCheckedModules(modules, nil, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stored := smartServiceRepo.GetModules(); len(stored) != 1 || stored[0].ModuleData["foo"] != "new" {
+		t.Error(stored)
+	}
+}
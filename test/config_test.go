@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		_, _, err := pkg.LoadConfig("../config.json")
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("env overrides", func(t *testing.T) {
+		t.Setenv("API_ADDRESS", ":9090")
+		t.Setenv("ENABLE_PREVIEW_API", "true")
+		t.Setenv("AUTH_CLIENT_SECRET", "secret")
+		t.Setenv("CAMUNDA_FETCH_MAX_TASKS", "3")
+		config, libConfig, err := pkg.LoadConfig("../config.json")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if config.ApiAddress != ":9090" || !config.EnablePreviewApi || libConfig.AuthClientSecret != "secret" || libConfig.CamundaFetchMaxTasks != 3 {
+			t.Errorf("%#v %#v", config, libConfig)
+		}
+		report := map[string]pkg.ConfigReportEntry{}
+		for _, entry := range pkg.GetConfigReport(config, libConfig) {
+			report[entry.Name] = entry
+		}
+		for name, expected := range map[string]pkg.ConfigReportEntry{
+			"api_address":             {Name: "api_address", Env: "API_ADDRESS", Value: ":9090", Source: pkg.ConfigSourceEnv},
+			"auth_client_secret":      {Name: "auth_client_secret", Env: "AUTH_CLIENT_SECRET", Value: "***", Source: pkg.ConfigSourceEnv},
+			"camunda_fetch_max_tasks": {Name: "camunda_fetch_max_tasks", Env: "CAMUNDA_FETCH_MAX_TASKS", Value: int64(3), Source: pkg.ConfigSourceEnv},
+			"worker_param_prefix":     {Name: "worker_param_prefix", Env: "WORKER_PARAM_PREFIX", Value: "info.", Source: pkg.ConfigSourceFile},
+		} {
+			if !reflect.DeepEqual(report[name], expected) {
+				t.Errorf("\n%#v\n%#v", report[name], expected)
+			}
+		}
+		for _, entry := range report {
+			if entry.Env != strings.ToUpper(entry.Name) {
+				t.Error("environment variable name does not match json name", entry.Env, entry.Name)
+			}
+		}
+	})
+
+	t.Run("invalid env", func(t *testing.T) {
+		t.Setenv("ENABLE_PREVIEW_API", "yes")
+		t.Setenv("CAMUNDA_FETCH_MAX_TASKS", "many")
+		_, _, err := pkg.LoadConfig("../config.json")
+		if err == nil || !strings.Contains(err.Error(), "ENABLE_PREVIEW_API") || !strings.Contains(err.Error(), "CAMUNDA_FETCH_MAX_TASKS") {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unsupported env", func(t *testing.T) {
+		t.Setenv("PROFILES", "info,widget")
+		_, _, err := pkg.LoadConfig("../config.json")
+		if !errors.Is(err, pkg.ErrUnsupportedConfigEnvironmentVar) || !strings.Contains(err.Error(), "PROFILES") {
+			t.Error(err)
+		}
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		t.Setenv("SHUTDOWN_DELAY", "soon")
+		t.Setenv("EXPIRED_MODULE_ACTION", "archive")
+		t.Setenv("ENABLE_PREVIEW_API", "true")
+		_, _, err := pkg.LoadConfig("../config.json")
+		expected := "enable_preview_api requires api_address\ninvalid shutdown_delay: time: invalid duration \"soon\"\nunknown expired_module_action: archive"
+		if err == nil || err.Error() != expected {
+			t.Error(err)
+		}
+	})
+}
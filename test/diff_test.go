@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestModuleDiffOutput(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	camunda.AddToQueue([]model.CamundaExternalTask{{
+		Id:                "task1",
+		ProcessInstanceId: "process-instance-1",
+		Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.diff_output": {Value: "widget_changes"},
+			"info.module_data": {Value: `{"title":"Temperature","series":[{"name":"a/b","values":[1,2]}],"unit":"°C"}`},
+		},
+	}})
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[{"id":"module-1","module_type":"info","module_data":{"title":"Temperature","series":[{"name":"a/b","values":[1,3,4]}],"color":"red"},"keys":["42"]}]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(1 * time.Second)
+
+	requests := camunda.PopRequestLog()
+	if len(requests) != 1 {
+		t.Error(requests)
+		return
+	}
+	complete := model.CamundaCompleteRequest{}
+	err = json.Unmarshal([]byte(requests[0].Message), &complete)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	output, ok := complete.Variables["widget_changes"].Value.(string)
+	if !ok {
+		t.Error(requests[0].Message)
+		return
+	}
+	actual := map[string][]pkg.ModuleDataChange{}
+	err = json.Unmarshal([]byte(output), &actual)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := map[string][]pkg.ModuleDataChange{
+		"module-1": {
+			{Op: pkg.ChangeRemove, Path: "/color", OldValue: "red"},
+			{Op: pkg.ChangeReplace, Path: "/series/0/values/1", Value: float64(2), OldValue: float64(3)},
+			{Op: pkg.ChangeRemove, Path: "/series/0/values/2", OldValue: float64(4)},
+			{Op: pkg.ChangeAdd, Path: "/unit", Value: "°C"},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\n%#v\n%#v", actual, expected)
+	}
+}
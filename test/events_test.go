@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+type producerMock struct {
+	mux      sync.Mutex
+	keys     []string
+	messages [][]byte
+}
+
+func (this *producerMock) Produce(key string, message []byte) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.keys = append(this.keys, key)
+	this.messages = append(this.messages, message)
+	return nil
+}
+
+func (this *producerMock) getEvents(t *testing.T) (events []pkg.ModuleEvent) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for i, message := range this.messages {
+		event := pkg.ModuleEvent{}
+		err := json.Unmarshal(message, &event)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if this.keys[i] != event.ModuleId {
+			t.Error("unexpected message key", this.keys[i], event.ModuleId)
+		}
+		if event.Time.IsZero() {
+			t.Error("missing event time", string(message))
+		}
+		event.Time = time.Time{}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestModuleEvents(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	producer := &producerMock{}
+	err = pkg.Start(ctx, wg, conf, libConf, pkg.WithModuleEventProducer(producer))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tasks := []map[string]model.CamundaVariable{
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"bar","batz":1}`}},
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"bar","batz":1}`}},
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"baz","new":true}`}},
+		{"info.key": {Value: "42"}, "info.mode": {Value: "delete"}},
+	}
+	for i, variables := range tasks {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                "task" + strconv.Itoa(i+1),
+			ProcessInstanceId: "process-instance-1",
+			Variables:         variables,
+		}})
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	base := pkg.ModuleEvent{
+		ModuleId:          "process-instance-1.task1",
+		Keys:              []string{"42"},
+		ModuleType:        "info",
+		ProcessInstanceId: "process-instance-1",
+		UserId:            "ebbad927-4c39-4d12-8690-89b067dd4ce7",
+	}
+	expected := []pkg.ModuleEvent{}
+	for i, eventType := range []string{pkg.ModuleCreated, pkg.ModuleUnchanged, pkg.ModuleUpdated, pkg.ModuleDeleted} {
+		event := base
+		event.Type = eventType
+		event.TaskId = "task" + strconv.Itoa(i+1)
+		expected = append(expected, event)
+	}
+	expected[1].Diff = &pkg.ModuleDiffSummary{}
+	expected[2].Diff = &pkg.ModuleDiffSummary{Added: []string{"new"}, Removed: []string{"batz"}, Changed: []string{"foo"}}
+	expected[2].Changes = []pkg.ModuleDataChange{
+		{Op: pkg.ChangeRemove, Path: "/batz", OldValue: float64(1)},
+		{Op: pkg.ChangeReplace, Path: "/foo", Value: "baz", OldValue: "bar"},
+		{Op: pkg.ChangeAdd, Path: "/new", Value: true},
+	}
+
+	actual := producer.getEvents(t)
+	if !reflect.DeepEqual(actual, expected) {
+		a, _ := json.Marshal(actual)
+		e, _ := json.Marshal(expected)
+		t.Errorf("\n%v\n%v", string(a), string(e))
+	}
+}
@@ -0,0 +1,295 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/smartservicerepository"
+)
+
+const expiryTestModules = `[
+	{"id":"expired","module_type":"info","module_data":{"_meta":{"expires_at":"2026-01-01T00:00:00Z","process_instance_id":"process-instance-1"}}},
+	{"id":"not-expired","module_type":"info","module_data":{"_meta":{"expires_at":"2026-12-01T00:00:00Z","process_instance_id":"process-instance-1"}}},
+	{"id":"without-expiry","module_type":"info","module_data":{"foo":"bar"}}
+]`
+
+func TestExpiredModuleSweep(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	t.Run("delete", func(t *testing.T) {
+		sweeper, smartServiceRepo := setupSweeperTest(t, pkg.ExpiredModuleActionDelete, clock)
+		if sweeper == nil {
+			return
+		}
+		err := sweeper.Sweep()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = smartServiceRepo.CheckExpectedRequests([]mocks.Request{
+			{Method: "GET", Endpoint: "/modules?limit=100&module_type=info"},
+			{Method: "GET", Endpoint: "/instances-by-process-id/process-instance-1/modules?module_type=info"},
+			{Method: "DELETE", Endpoint: "/instances-by-process-id/process-instance-1/modules/expired"},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		checkModuleIds(t, smartServiceRepo, "not-expired", "without-expiry")
+	})
+
+	t.Run("mark", func(t *testing.T) {
+		sweeper, smartServiceRepo := setupSweeperTest(t, pkg.ExpiredModuleActionMark, clock)
+		if sweeper == nil {
+			return
+		}
+		//the second sweep ignores the already marked module
+		for i := 0; i < 2; i++ {
+			err := sweeper.Sweep()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		err := smartServiceRepo.CheckExpectedRequests([]mocks.Request{
+			{Method: "GET", Endpoint: "/modules?limit=100&module_type=info"},
+			{Method: "PUT", Endpoint: "/modules/expired/error", Message: `"info: module expired"` + "\n"},
+			{Method: "GET", Endpoint: "/modules?limit=100&module_type=info"},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		checkModuleIds(t, smartServiceRepo, "expired", "not-expired", "without-expiry")
+	})
+
+	t.Run("delete info and history", func(t *testing.T) {
+		deleteInfoRequests := 0
+		deleteInfoServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.Method == http.MethodDelete {
+				deleteInfoRequests++
+			}
+		}))
+		defer deleteInfoServer.Close()
+		history, err := pkg.NewFileHistoryStore(t.TempDir())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		modules := `[{"id":"expired","module_type":"info","keys":["42"],"delete_info":{"url":"` + deleteInfoServer.URL + `/resource"},"module_data":{"_meta":{"expires_at":"2026-01-01T00:00:00Z","process_instance_id":"process-instance-1"}}}]`
+		sweeper, smartServiceRepo := setupSweeperTestWithModules(t, pkg.ExpiredModuleActionDelete, clock, modules, history)
+		if sweeper == nil {
+			return
+		}
+		err = sweeper.Sweep()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if deleteInfoRequests != 1 {
+			t.Error("expected one delete info request, got", deleteInfoRequests)
+		}
+		if modules := smartServiceRepo.GetModules(); len(modules) != 0 {
+			t.Errorf("%#v", modules)
+		}
+		revisions, err := history.List("expired")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(revisions) != 1 || revisions[0].Type != pkg.ModuleDeleted || revisions[0].ProcessInstanceId != "process-instance-1" {
+			t.Errorf("%#v", revisions)
+		}
+	})
+
+	//modules of other workers and modules, whose metadata names a process instance that does not own them, are not deleted
+	t.Run("foreign modules", func(t *testing.T) {
+		modules := `[
+			{"id":"expired","module_type":"info","module_data":{"_meta":{"expires_at":"2026-01-01T00:00:00Z","process_instance_id":"process-instance-1"}}},
+			{"id":"other-worker","module_type":"process-deployment","module_data":{"_meta":{"expires_at":"2026-01-01T00:00:00Z","process_instance_id":"process-instance-1"}}},
+			{"id":"injected","module_type":"info","module_data":{"_meta":{"expires_at":"2026-01-01T00:00:00Z","process_instance_id":"process-instance-1"}}}
+		]`
+		sweeper, smartServiceRepo := setupSweeperTestWithModules(t, pkg.ExpiredModuleActionDelete, clock, modules, nil)
+		if sweeper == nil {
+			return
+		}
+		smartServiceRepo.SetProcessInstanceModules(map[string][]string{
+			"process-instance-1": {"expired"},
+			"process-instance-2": {"injected", "other-worker"},
+		})
+		err := sweeper.Sweep()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		checkModuleIds(t, smartServiceRepo, "other-worker", "injected")
+	})
+
+	t.Run("clock", func(t *testing.T) {
+		later := func() time.Time { return now.AddDate(1, 0, 0) }
+		sweeper, smartServiceRepo := setupSweeperTest(t, pkg.ExpiredModuleActionDelete, later)
+		if sweeper == nil {
+			return
+		}
+		err := sweeper.Sweep()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		checkModuleIds(t, smartServiceRepo, "without-expiry")
+	})
+}
+
+func TestExpiredModuleSweeperStop(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.ExpiredModuleSweepInterval = "10ms"
+
+	mockWg := &sync.WaitGroup{}
+	defer mockWg.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, mockWg)
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(expiryTestModules))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, mockWg)
+
+	authentication := auth.New(libConf)
+	repo := pkg.NewSmartServiceRepository(libConf, authentication, smartservicerepository.New(libConf, authentication), nil, nil, nil, nil, nil)
+	sweeper, err := pkg.NewSweeper(conf, libConf, repo, func() time.Time { return time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC) })
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sweeperCtx, stopSweeper := context.WithCancel(ctx)
+	defer stopSweeper()
+	sweeperWg := &sync.WaitGroup{}
+	err = sweeper.Start(sweeperCtx, sweeperWg)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(200 * time.Millisecond)
+	stopSweeper()
+
+	done := make(chan struct{})
+	go func() {
+		sweeperWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("sweeper did not stop after context cancellation")
+		return
+	}
+
+	checkModuleIds(t, smartServiceRepo, "not-expired", "without-expiry")
+
+	//no sweeps after stop
+	count := len(smartServiceRepo.GetRequestLog())
+	time.Sleep(100 * time.Millisecond)
+	if len(smartServiceRepo.GetRequestLog()) != count {
+		t.Error("unexpected requests after sweeper stop")
+	}
+}
+
+func TestExpiredModuleSweeperInvalidConfig(t *testing.T) {
+	_, err := pkg.NewSweeper(pkg.Config{ExpiredModuleAction: "archive"}, configuration.Config{}, nil, nil)
+	if err == nil {
+		t.Error("expected error for unknown action")
+	}
+	sweeper, err := pkg.NewSweeper(pkg.Config{ExpiredModuleSweepInterval: "often"}, configuration.Config{}, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = sweeper.Start(context.Background(), &sync.WaitGroup{})
+	if err == nil {
+		t.Error("expected error for invalid interval")
+	}
+}
+
+func setupSweeperTest(t *testing.T, action string, clock func() time.Time) (*pkg.Sweeper, *mocks.SmartServiceRepoMock) {
+	return setupSweeperTestWithModules(t, action, clock, expiryTestModules, nil)
+}
+
+func setupSweeperTestWithModules(t *testing.T, action string, clock func() time.Time, modules string, history pkg.HistoryStore) (*pkg.Sweeper, *mocks.SmartServiceRepoMock) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return nil, nil
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return nil, nil
+	}
+	conf.ExpiredModuleAction = action
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(modules))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	authentication := auth.New(libConf)
+	repo := pkg.NewSmartServiceRepository(libConf, authentication, smartservicerepository.New(libConf, authentication), nil, history, nil, nil, nil)
+	sweeper, err := pkg.NewSweeper(conf, libConf, repo, clock)
+	if err != nil {
+		t.Error(err)
+		return nil, nil
+	}
+	return sweeper, smartServiceRepo
+}
+
+func checkModuleIds(t *testing.T, smartServiceRepo *mocks.SmartServiceRepoMock, expected ...string) {
+	t.Helper()
+	actual := []string{}
+	for _, module := range smartServiceRepo.GetModules() {
+		actual = append(actual, module.Id)
+	}
+	a, _ := json.Marshal(actual)
+	e, _ := json.Marshal(expected)
+	if string(a) != string(e) {
+		t.Errorf("\n%v\n%v", string(a), string(e))
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+)
+
+func TestHealth(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.ShutdownDelay = "1s"
+	conf.ApiAddress, err = getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockCtx, mockCancel := context.WithCancel(context.Background())
+	defer mockCancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(mockCtx, wg)
+	libConf.AuthEndpoint = mocks.Keycloak(mockCtx, wg)
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(mockCtx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Second)
+
+	healthUrl := "http://" + conf.ApiAddress + "/health"
+	readyUrl := "http://" + conf.ApiAddress + "/ready"
+
+	health := pkg.HealthStatus{}
+	err = getJson(healthUrl, &health)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !health.CamundaLoopRunning || health.LastFetchSuccess == nil || health.Status != pkg.HealthStatusOk {
+		t.Errorf("%#v", health)
+	}
+
+	ready := pkg.HealthStatus{}
+	err = getJson(readyUrl, &ready)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if ready.Status != pkg.HealthStatusOk || ready.Auth != pkg.HealthStatusOk || ready.SmartServiceRepository != pkg.HealthStatusOk {
+		t.Errorf("%#v", ready)
+	}
+
+	cancel()
+	time.Sleep(500 * time.Millisecond)
+
+	resp, err := http.Get(readyUrl)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Error("unexpected ready status code", resp.StatusCode)
+	}
+	ready = pkg.HealthStatus{}
+	err = json.NewDecoder(resp.Body).Decode(&ready)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !ready.ShuttingDown || ready.Status != pkg.HealthStatusUnavailable {
+		t.Errorf("%#v", ready)
+	}
+}
+
+func TestHealthFetchError(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.ShutdownDelay = ""
+	conf.ApiAddress, err = getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//nothing listens on the camunda address
+	camundaAddress, err := getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaUrl = "http://" + camundaAddress
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Second)
+
+	health := pkg.HealthStatus{}
+	err = getJson("http://"+conf.ApiAddress+"/health", &health)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//the loop has been started within health_max_fetch_age
+	if !health.CamundaLoopRunning || health.LastFetchSuccess != nil || !strings.Contains(health.LastFetchError, "connection refused") || health.Status != pkg.HealthStatusOk {
+		t.Errorf("%#v", health)
+	}
+}
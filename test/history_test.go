@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestFileHistoryStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := pkg.NewFileHistoryStore(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, id := range []string{"a/1", "b", "a/1"} {
+		_, err = store.Add(pkg.ModuleRevision{ModuleId: id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	//revisions are persisted
+	store, err = pkg.NewFileHistoryStore(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	revision, err := store.Add(pkg.ModuleRevision{ModuleId: "a/1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if revision.Revision != 3 {
+		t.Error(revision.Revision)
+	}
+	revisions, err := store.List("a/1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i, r := range revisions {
+		if r.Revision != i+1 || r.ModuleId != "a/1" {
+			t.Error(i, r)
+		}
+	}
+	if len(revisions) != 3 {
+		t.Error(len(revisions))
+	}
+	revisions, err = store.List("unknown")
+	if err != nil || len(revisions) != 0 {
+		t.Error(err, revisions)
+	}
+}
+
+func TestModuleHistoryRestore(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.HistoryDir = t.TempDir()
+	conf.ShutdownDelay = ""
+	conf.ApiAddress, err = getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.AdminApiAddress, err = getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i, data := range []string{`{"version":1}`, `{"version":2}`} {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                fmt.Sprintf("task%v", i+1),
+			ProcessInstanceId: "process-instance-1",
+			Variables: map[string]model.CamundaVariable{
+				"info.key":         {Value: "42"},
+				"info.module_data": {Value: data},
+			},
+		}})
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	moduleId := "process-instance-1.task1"
+	revisionsUrl := "http://" + conf.AdminApiAddress + "/modules/" + moduleId + "/revisions"
+
+	//the history is not served by the unauthenticated api of the probes
+	err = postExpectStatus("http://"+conf.ApiAddress+"/modules/"+moduleId+"/revisions/1/restore", http.StatusNotFound, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	revisions := []pkg.ModuleRevision{}
+	err = getJson(revisionsUrl, &revisions)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkRevisions(t, revisions, []string{pkg.ModuleCreated, pkg.ModuleUpdated}, []string{"task1", "task2"}, []float64{1, 2})
+
+	err = postExpectStatus(revisionsUrl+"/1/restore", http.StatusOK, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	modules := smartServiceRepo.GetModules()
+	if len(modules) != 1 || !reflect.DeepEqual(modules[0].ModuleData, map[string]interface{}{"version": float64(1)}) {
+		t.Errorf("%#v", modules)
+	}
+
+	err = getJson(revisionsUrl, &revisions)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkRevisions(t, revisions, []string{pkg.ModuleCreated, pkg.ModuleUpdated, pkg.ModuleRestored}, []string{"task1", "task2", "task1"}, []float64{1, 2, 1})
+
+	err = postExpectStatus(revisionsUrl+"/42/restore", http.StatusNotFound, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func checkRevisions(t *testing.T, revisions []pkg.ModuleRevision, types []string, taskIds []string, versions []float64) {
+	t.Helper()
+	if len(revisions) != len(types) {
+		t.Errorf("%#v", revisions)
+		return
+	}
+	for i, revision := range revisions {
+		if revision.Revision != i+1 || revision.Type != types[i] || revision.TaskId != taskIds[i] || revision.ProcessInstanceId != "process-instance-1" || revision.Time.IsZero() {
+			t.Errorf("%v: %#v", i, revision)
+		}
+		if revision.Module.ModuleData["version"] != versions[i] || !reflect.DeepEqual(revision.Keys, []string{"42"}) {
+			t.Errorf("%v: %#v", i, revision.Module)
+		}
+	}
+}
+
+func getJson(url string, result interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+)
+
+func TestLintBpmn(t *testing.T) {
+	bpmn, err := os.ReadFile("resources/lint/process.bpmn")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	config := pkg.Config{WorkerParamPrefix: "info.", EnableAdditionalModuleDataFields: true}
+	findings, err := pkg.LintBpmn(config, "info", "process.bpmn", bpmn)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	type finding struct {
+		TaskId    string
+		Parameter string
+		Severity  string
+		Code      string
+	}
+	actual := []finding{}
+	for _, f := range findings {
+		if f.File != "process.bpmn" || f.ProcessId != "process_1" || f.Message == "" {
+			t.Errorf("%#v", f)
+		}
+		actual = append(actual, finding{TaskId: f.TaskId, Parameter: f.Parameter, Severity: f.Severity, Code: f.Code})
+	}
+	expected := []finding{
+		{TaskId: "large", Parameter: "info.module_data_3", Severity: pkg.LintSeverityWarning, Code: "part_order"},
+		{TaskId: "broken", Parameter: "Info.mode", Severity: pkg.LintSeverityWarning, Code: "misspelled_prefix"},
+		{TaskId: "broken", Parameter: "info.modee", Severity: pkg.LintSeverityWarning, Code: "unknown_parameter"},
+		{TaskId: "broken", Parameter: "info.title", Severity: pkg.LintSeverityWarning, Code: "unknown_parameter"},
+		{TaskId: "broken", Parameter: "info.module_data_2", Severity: pkg.LintSeverityError, Code: "part_order"},
+		{TaskId: "broken", Parameter: "info.module_data", Severity: pkg.LintSeverityError, Code: "invalid_json"},
+		{TaskId: "broken", Parameter: "info.on_conflict", Severity: pkg.LintSeverityError, Code: "invalid_on_conflict"},
+		{TaskId: "broken", Parameter: "info.module_data_ref", Severity: pkg.LintSeverityError, Code: "invalid_module_data_ref"},
+		{TaskId: "event", Parameter: "info.module_data", Severity: pkg.LintSeverityWarning, Code: "dynamic_value"},
+		{TaskId: "event", Parameter: "info.mode", Severity: pkg.LintSeverityError, Code: "mode_without_key"},
+		{TaskId: "broken", Parameter: "info.module_type", Severity: pkg.LintSeverityError, Code: "inconsistent_module_type"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\n%#v\n%#v", actual, expected)
+	}
+
+	config.EnableAdditionalModuleDataFields = false
+	findings, err = pkg.LintBpmn(config, "info", "process.bpmn", bpmn)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, f := range findings {
+		if f.Parameter == "info.title" && f.Message != "unknown parameter is ignored" {
+			t.Error(f.Message)
+		}
+	}
+
+	_, err = pkg.LintBpmn(config, "info", "invalid.bpmn", []byte("<bpmn:definitions"))
+	if err == nil {
+		t.Error("expected parse error")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestMetrics(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.ShutdownDelay = ""
+	conf.ApiAddress, err = getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	for i, variables := range []map[string]model.CamundaVariable{
+		{"info.module_data_1": {Value: `{"foo":`}, "info.module_data_2": {Value: `"bar"}`}},
+		{"info.module_data": {Value: `{"foo":`}},
+		{"info.module_data": {Value: 42}},
+		{"info.key": {Value: "42"}, "info.module_data": {Value: `{"foo":"batz"}`}},
+		{"info.module_type": {Value: "custom-type-1"}, "info.module_data": {Value: `{}`}},
+	} {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                "task" + strconv.Itoa(i+1),
+			ProcessInstanceId: "process-instance-1",
+			Variables:         variables,
+		}})
+	}
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(2 * time.Second)
+
+	resp, err := http.Get("http://" + conf.ApiAddress + "/metrics")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+	temp, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metrics := string(temp)
+	for _, expected := range []string{
+		`info_worker_modules_total{action="module_created",module_type="info"} 2`,
+		`info_worker_modules_total{action="module_created",module_type="other"} 1`,
+		`info_worker_errors_total{cause="invalid_json"} 1`,
+		`info_worker_errors_total{cause="not_string"} 1`,
+		`info_worker_module_data_parts_sum 5`,
+		`info_worker_module_data_parts_count 4`,
+		`info_worker_repository_request_duration_seconds_count{operation="list_existing_modules"} 1`,
+		`info_worker_repository_request_duration_seconds_count{operation="send_modules"} 3`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Error("missing metric", expected)
+		}
+	}
+	if strings.Contains(metrics, `module_type="custom-type-1"`) {
+		t.Error("unexpected module type label")
+	}
+	if strings.Contains(metrics, `cause="repository_error"`) {
+		t.Error("unexpected repository error")
+	}
+}
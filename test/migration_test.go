@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// used by testcases/migration-*
+func init() {
+	pkg.RegisterMigration("migration-test-widget", 1, func(data map[string]interface{}) (map[string]interface{}, error) {
+		title, ok := data["title"]
+		if ok {
+			data["header"] = map[string]interface{}{"text": title}
+			delete(data, "title")
+		}
+		return data, nil
+	})
+	pkg.RegisterMigration("migration-test-broken", 1, func(data map[string]interface{}) (map[string]interface{}, error) {
+		return data, errors.New("broken migration")
+	})
+}
+
+func TestExistingModuleMigration(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	existing := []model.SmartServiceModule{
+		{SmartServiceModuleBase: model.SmartServiceModuleBase{Id: "module-1"}, SmartServiceModuleInit: model.SmartServiceModuleInit{
+			ModuleType: "migration-test-widget",
+			ModuleData: map[string]interface{}{"title": "foo", "module_version": 1},
+			Keys:       []string{"1"},
+		}},
+		{SmartServiceModuleBase: model.SmartServiceModuleBase{Id: "module-2"}, SmartServiceModuleInit: model.SmartServiceModuleInit{
+			ModuleType: "migration-test-broken",
+			ModuleData: map[string]interface{}{"title": "foo", "module_version": 1},
+			Keys:       []string{"2"},
+		}},
+	}
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "1"},
+			"info.module_type": {Value: "migration-test-widget"},
+			"info.diff_output": {Value: "changes"},
+			"info.module_data": {Value: `{"title":"bar"}`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":            {Value: "2"},
+			"info.module_type":    {Value: "migration-test-broken"},
+			"info.module_version": {Value: "2"},
+			"info.module_data":    {Value: `{"text":"bar"}`},
+		}},
+	}
+	results, ok := pkg.Render(conf, libConf, tasks, existing)
+	if !ok || len(results) != 2 {
+		t.Errorf("%#v", results)
+		return
+	}
+
+	//the stored v1 data is compared after its migration to v2
+	actual := map[string][]pkg.ModuleDataChange{}
+	output, _ := results[0].Outputs["changes"].(string)
+	err = json.Unmarshal([]byte(output), &actual)
+	if err != nil {
+		t.Error(err, results[0].Outputs)
+		return
+	}
+	expected := map[string][]pkg.ModuleDataChange{
+		"module-1": {{Op: pkg.ChangeReplace, Path: "/header/text", Value: "bar", OldValue: "foo"}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\n%#v\n%#v", actual, expected)
+	}
+
+	//stored data that can not be migrated does not block the update
+	if len(results[1].Modules) != 1 || !reflect.DeepEqual(results[1].Modules[0].ModuleData, map[string]interface{}{"text": "bar", "module_version": 2}) {
+		t.Errorf("%#v", results[1])
+	}
+}
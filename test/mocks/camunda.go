@@ -41,12 +41,14 @@ type Response struct {
 
 func NewCamundaMock() *CamundaMock {
 	return &CamundaMock{
-		Queue: make(chan []model.CamundaExternalTask, 20),
+		Queue:       make(chan []model.CamundaExternalTask, 20),
+		topicQueues: map[string]chan []model.CamundaExternalTask{},
 	}
 }
 
 type CamundaMock struct {
 	Queue       chan []model.CamundaExternalTask
+	topicQueues map[string]chan []model.CamundaExternalTask
 	requestsLog []Request
 	mux         sync.Mutex
 }
@@ -60,6 +62,33 @@ func (this *CamundaMock) Fetch() (result []model.CamundaExternalTask) {
 	}
 }
 
+// FetchTopics returns tasks added with AddToTopicQueue for the requested topics; tasks of Queue are returned for every topic
+func (this *CamundaMock) FetchTopics(topics []model.CamundaTopic) (result []model.CamundaExternalTask) {
+	for _, topic := range topics {
+		select {
+		case result = <-this.getTopicQueue(topic.Name):
+			return result
+		default:
+		}
+	}
+	return this.Fetch()
+}
+
+func (this *CamundaMock) AddToTopicQueue(topic string, fetchResult []model.CamundaExternalTask) {
+	this.getTopicQueue(topic) <- fetchResult
+}
+
+func (this *CamundaMock) getTopicQueue(topic string) chan []model.CamundaExternalTask {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	queue, ok := this.topicQueues[topic]
+	if !ok {
+		queue = make(chan []model.CamundaExternalTask, 20)
+		this.topicQueues[topic] = queue
+	}
+	return queue
+}
+
 func (this *CamundaMock) AddToQueue(fetchResult []model.CamundaExternalTask) {
 	this.Queue <- fetchResult
 }
@@ -108,7 +137,9 @@ func (this *CamundaMock) getRouter() http.Handler {
 
 	router.POST("/engine-rest/external-task/:taskId", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 		if params.ByName("taskId") == "fetchAndLock" {
-			list := this.Fetch()
+			fetchRequest := model.CamundaFetchRequest{}
+			json.NewDecoder(request.Body).Decode(&fetchRequest)
+			list := this.FetchTopics(fetchRequest.Topics)
 			json.NewEncoder(writer).Encode(list)
 			return
 		} else {
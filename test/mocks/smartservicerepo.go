@@ -22,17 +22,26 @@ import (
 	"fmt"
 	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
 	"github.com/julienschmidt/httprouter"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// if moduleListResponse is a valid module list, the mock stores written and deleted modules
 func NewSmartServiceRepoMock(libConfig configuration.Config, config pkg.Config, moduleListResponse []byte) *SmartServiceRepoMock {
-	return &SmartServiceRepoMock{libConfig: libConfig, config: config, moduleListResponse: moduleListResponse}
+	result := &SmartServiceRepoMock{libConfig: libConfig, config: config, moduleListResponse: moduleListResponse}
+	err := json.Unmarshal(moduleListResponse, &result.modules)
+	result.modulesValid = err == nil
+	return result
 }
 
 type SmartServiceRepoMock struct {
@@ -41,6 +50,142 @@ type SmartServiceRepoMock struct {
 	libConfig          configuration.Config
 	config             pkg.Config
 	moduleListResponse []byte
+	modules            []model.SmartServiceModule
+	modulesValid       bool
+	listBarrier        *requestBarrier
+	writeBarrier       *requestBarrier
+	variables          map[string]interface{}
+	instanceModules    map[string][]string
+}
+
+// SetProcessInstanceModules sets the ids of the modules owned by each process instance;
+// if set, modules are listed and deleted by process instance only for their owning process instance
+func (this *SmartServiceRepoMock) SetProcessInstanceModules(modules map[string][]string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.instanceModules = modules
+}
+
+func (this *SmartServiceRepoMock) isProcessInstanceModule(processInstanceId string, moduleId string) bool {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.instanceModules == nil || slices.Contains(this.instanceModules[processInstanceId], moduleId)
+}
+
+// SetVariables replaces the process variables returned by the variables-map endpoint
+func (this *SmartServiceRepoMock) SetVariables(variables map[string]interface{}) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.variables = variables
+}
+
+func (this *SmartServiceRepoMock) getVariables() []byte {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.variables == nil {
+		return []byte(`{}`)
+	}
+	temp, _ := json.Marshal(this.variables)
+	return temp
+}
+
+// module list requests block until count list requests have been received (or 5s passed)
+func (this *SmartServiceRepoMock) SetModuleListBarrier(count int) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.listBarrier = newRequestBarrier(count)
+}
+
+// module writes are stored immediately, but their responses block until count writes have been received (or 5s passed)
+func (this *SmartServiceRepoMock) SetModuleWriteBarrier(count int) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.writeBarrier = newRequestBarrier(count)
+}
+
+type requestBarrier struct {
+	done  chan struct{}
+	count int
+}
+
+func newRequestBarrier(count int) *requestBarrier {
+	return &requestBarrier{done: make(chan struct{}), count: count}
+}
+
+func (this *SmartServiceRepoMock) waitForBarrier(barrier **requestBarrier) {
+	this.mux.Lock()
+	current := *barrier
+	if current == nil {
+		this.mux.Unlock()
+		return
+	}
+	current.count--
+	if current.count == 0 {
+		close(current.done)
+		*barrier = nil
+	}
+	this.mux.Unlock()
+	select {
+	case <-current.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (this *SmartServiceRepoMock) GetModules() []model.SmartServiceModule {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return slices.Clone(this.modules)
+}
+
+func (this *SmartServiceRepoMock) storeModule(id string, init model.SmartServiceModuleInit) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if !this.modulesValid {
+		return
+	}
+	for i, module := range this.modules {
+		if module.Id == id {
+			this.modules[i].SmartServiceModuleInit = init
+			return
+		}
+	}
+	this.modules = append(this.modules, model.SmartServiceModule{
+		SmartServiceModuleBase: model.SmartServiceModuleBase{Id: id, UserId: userId},
+		SmartServiceModuleInit: init,
+	})
+}
+
+func (this *SmartServiceRepoMock) setModuleError(id string, msg string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for i, module := range this.modules {
+		if module.Id == id {
+			this.modules[i].Error = msg
+			return
+		}
+	}
+}
+
+// returns false, if the stored modules are known and do not contain the module
+func (this *SmartServiceRepoMock) removeModule(id string) (found bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	count := len(this.modules)
+	this.modules = slices.DeleteFunc(this.modules, func(module model.SmartServiceModule) bool {
+		return module.Id == id
+	})
+	return !this.modulesValid || len(this.modules) < count
+}
+
+func (this *SmartServiceRepoMock) getModule(id string) (module model.SmartServiceModule, ok bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for _, module := range this.modules {
+		if module.Id == id {
+			return module, true
+		}
+	}
+	return module, false
 }
 
 func (this *SmartServiceRepoMock) PopRequestLog() []Request {
@@ -96,9 +241,28 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 			Endpoint: request.URL.Path,
 			Message:  msg,
 		})
+		init := model.SmartServiceModuleInit{}
+		if json.Unmarshal(temp, &init) == nil {
+			this.storeModule(params.ByName("moduleId"), init)
+		}
+		this.waitForBarrier(&this.writeBarrier)
 		writer.Write(temp)
 	})
 
+	router.DELETE("/instances-by-process-id/:id/modules/:moduleId", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		temp, _ := io.ReadAll(request.Body)
+		this.logRequest(Request{
+			Method:   request.Method,
+			Endpoint: request.URL.Path,
+			Message:  string(temp),
+		})
+		if !this.isProcessInstanceModule(params.ByName("id"), params.ByName("moduleId")) || !this.removeModule(params.ByName("moduleId")) {
+			http.Error(writer, "module not found", http.StatusNotFound)
+			return
+		}
+		writer.WriteHeader(200)
+	})
+
 	router.GET("/instances-by-process-id/:id/modules", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 		temp, _ := io.ReadAll(request.Body)
 		msg := string(temp)
@@ -107,7 +271,46 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 			Endpoint: request.URL.Path + "?" + request.URL.Query().Encode(),
 			Message:  msg,
 		})
-		writer.Write(this.moduleListResponse)
+		this.waitForBarrier(&this.listBarrier)
+		writer.Write(this.filterModuleListResponse(request.URL.Query(), params.ByName("id")))
+	})
+
+	router.GET("/modules", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		temp, _ := io.ReadAll(request.Body)
+		this.logRequest(Request{
+			Method:   request.Method,
+			Endpoint: request.URL.Path + "?" + request.URL.Query().Encode(),
+			Message:  string(temp),
+		})
+		writer.Write(this.filterModuleListResponse(request.URL.Query(), ""))
+	})
+
+	router.PUT("/modules/:id/error", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		temp, _ := io.ReadAll(request.Body)
+		this.logRequest(Request{
+			Method:   request.Method,
+			Endpoint: request.URL.Path,
+			Message:  string(temp),
+		})
+		msg := ""
+		json.Unmarshal(temp, &msg)
+		this.setModuleError(params.ByName("id"), msg)
+		writer.WriteHeader(200)
+	})
+
+	router.GET("/modules/:id", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		temp, _ := io.ReadAll(request.Body)
+		this.logRequest(Request{
+			Method:   request.Method,
+			Endpoint: request.URL.Path,
+			Message:  string(temp),
+		})
+		module, ok := this.getModule(params.ByName("id"))
+		if !ok {
+			http.Error(writer, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(writer).Encode(module)
 	})
 
 	router.GET("/instances-by-process-id/:id/user-id", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -127,7 +330,7 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 			Endpoint: request.URL.Path,
 			Message:  string(temp),
 		})
-		writer.Write([]byte(`{}`))
+		writer.Write(this.getVariables())
 	})
 
 	router.PUT("/instances-by-process-id/:id/variables-map", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -143,6 +346,36 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 	return router
 }
 
+// filters the stored modules by key and module_type; returns moduleListResponse if it is no valid module list
+// processInstanceId is empty for lists of all modules
+func (this *SmartServiceRepoMock) filterModuleListResponse(query url.Values, processInstanceId string) []byte {
+	if !this.modulesValid {
+		return this.moduleListResponse
+	}
+	key, moduleType := query.Get("key"), query.Get("module_type")
+	result := []model.SmartServiceModule{}
+	for _, module := range this.GetModules() {
+		if key != "" && !slices.Contains(module.Keys, key) {
+			continue
+		}
+		if moduleType != "" && module.ModuleType != moduleType {
+			continue
+		}
+		if processInstanceId != "" && !this.isProcessInstanceModule(processInstanceId, module.Id) {
+			continue
+		}
+		result = append(result, module)
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil {
+		result = result[min(offset, len(result)):]
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil {
+		result = result[:min(limit, len(result))]
+	}
+	temp, _ := json.Marshal(result)
+	return temp
+}
+
 func (this *SmartServiceRepoMock) CheckExpectedRequests(expectedRequests []Request) error {
 	actualEngineRequests := this.GetRequestLog()
 	if !reflect.DeepEqual(expectedRequests, actualEngineRequests) {
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestPreviewApi(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.EnablePreviewApi = true
+	conf.Profiles = []pkg.Profile{
+		{CamundaWorkerTopic: "info", WorkerParamPrefix: "info.", EnableAdditionalModuleDataFields: conf.EnableAdditionalModuleDataFields},
+		{CamundaWorkerTopic: "widget", WorkerParamPrefix: "widget.", RequireKey: true},
+	}
+	conf.ShutdownDelay = ""
+	conf.ApiAddress, err = getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	previewUrl := "http://" + conf.ApiAddress + "/preview"
+
+	t.Run("module", func(t *testing.T) {
+		result, err := postPreview(previewUrl, map[string]model.CamundaVariable{
+			"info.key":           {Value: "42"},
+			"info.module_type":   {Value: "widget"},
+			"info.module_data_1": {Value: `{"foo":`},
+			"info.module_data_2": {Value: `"bar"}`},
+			"info.title":         {Value: "Status"},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := model.SmartServiceModuleInit{
+			ModuleType: "widget",
+			ModuleData: map[string]interface{}{"foo": "bar", "title": "Status"},
+			Keys:       []string{"42"},
+		}
+		if result.Error != "" || result.Module == nil || !reflect.DeepEqual(*result.Module, expected) {
+			t.Errorf("%#v", result)
+		}
+		if len(result.Findings) != 1 || result.Findings[0].Code != "unknown_parameter" || result.Findings[0].Parameter != "info.title" {
+			t.Errorf("%#v", result.Findings)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		result, err := postPreview(previewUrl, map[string]model.CamundaVariable{
+			"info.module_data": {Value: `{"foo":`},
+			"info.mode":        {Value: "delete"},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if result.Module != nil || result.Error != "invalid json for module_data: unexpected end of JSON input, ({\"foo\":)" {
+			t.Errorf("%#v", result)
+		}
+		codes := []string{}
+		for _, finding := range result.Findings {
+			codes = append(codes, finding.Code)
+		}
+		if !reflect.DeepEqual(codes, []string{"invalid_json", "mode_without_key"}) {
+			t.Errorf("%#v", result.Findings)
+		}
+	})
+
+	t.Run("modules", func(t *testing.T) {
+		result, err := postPreview(previewUrl, map[string]model.CamundaVariable{
+			"info.modules": {Value: `[{"key": "a", "module_data": {"foo": 1}}, {"module_type": "other", "module_data": {"foo": 2}}]`},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := []model.SmartServiceModuleInit{
+			{ModuleType: "info", ModuleData: map[string]interface{}{"foo": float64(1)}, Keys: []string{"a"}},
+			{ModuleType: "other", ModuleData: map[string]interface{}{"foo": float64(2)}, Keys: []string{}},
+		}
+		if result.Error != "" || !reflect.DeepEqual(result.Modules, expected) {
+			t.Errorf("%#v", result)
+		}
+	})
+
+	t.Run("topic", func(t *testing.T) {
+		result, err := postPreview(previewUrl+"?topic=widget", map[string]model.CamundaVariable{
+			"widget.module_data": {Value: `{"foo":"bar"}`},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if result.Module != nil || result.Error != "missing required key" {
+			t.Errorf("%#v", result)
+		}
+		result, err = postPreview(previewUrl+"?topic=widget", map[string]model.CamundaVariable{
+			"widget.key":         {Value: "42"},
+			"widget.module_data": {Value: `{"foo":"bar"}`},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := model.SmartServiceModuleInit{ModuleType: "widget", ModuleData: map[string]interface{}{"foo": "bar"}, Keys: []string{"42"}}
+		if result.Error != "" || result.Module == nil || !reflect.DeepEqual(*result.Module, expected) {
+			t.Errorf("%#v", result)
+		}
+	})
+
+	t.Run("unknown topic", func(t *testing.T) {
+		_, err := postPreview(previewUrl+"?topic=unknown", map[string]model.CamundaVariable{})
+		if err == nil || err.Error() != "unexpected status code 404" {
+			t.Error(err)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		_, err := postPreview(previewUrl, map[string]model.CamundaVariable{
+			"info.module_data": {Value: `"` + strings.Repeat("a", pkg.PreviewMaxBodySize) + `"`},
+		})
+		if err == nil || err.Error() != "unexpected status code 413" {
+			t.Error(err)
+		}
+	})
+
+	for _, request := range smartServiceRepo.GetRequestLog() {
+		if request.Method != http.MethodGet {
+			t.Error("unexpected smart service repository request", request)
+		}
+	}
+}
+
+func postPreview(url string, variables map[string]model.CamundaVariable) (result pkg.PreviewResult, err error) {
+	body, err := json.Marshal(variables)
+	if err != nil {
+		return result, err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestModuleProcessors(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	processor := pkg.ModuleProcessorFunc(func(ctx context.Context, task model.CamundaExternalTask, init *model.SmartServiceModuleInit, existing *model.Module) error {
+		if init.ModuleData["fail"] == true {
+			return errors.New("rejected by processor")
+		}
+		init.ModuleData["processed"] = true
+		if existing != nil {
+			init.ModuleData["previous"] = existing.ModuleData["foo"]
+		}
+		return nil
+	})
+	err = pkg.Start(ctx, wg, conf, libConf, pkg.WithModuleProcessors(processor))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.color":       {Value: `"red"`},
+			"info.module_data": {Value: `{"foo":"a"}`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.module_data": {Value: `{"foo":"b"}`},
+		}},
+		{Id: "task3", ProcessInstanceId: "process-instance-2", Variables: map[string]model.CamundaVariable{
+			"info.module_data": {Value: `{"fail":true}`},
+		}},
+	}
+	expected := []map[string]interface{}{
+		{"foo": "a", "color": "red", "processed": true},
+		{"foo": "b", "processed": true, "previous": "a"},
+	}
+	for i, task := range tasks {
+		camunda.AddToQueue([]model.CamundaExternalTask{task})
+		time.Sleep(500 * time.Millisecond)
+		if i >= len(expected) {
+			continue
+		}
+		modules := smartServiceRepo.GetModules()
+		if len(modules) != 1 || !reflect.DeepEqual(modules[0].ModuleData, expected[i]) {
+			t.Errorf("\n%#v\n%#v", modules, expected[i])
+		}
+	}
+
+	workerError := ""
+	for _, request := range smartServiceRepo.GetRequestLog() {
+		if request.Endpoint == "/instances-by-process-id/process-instance-2/error" {
+			err = json.Unmarshal([]byte(request.Message), &workerError)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	if workerError != "info: rejected by processor" {
+		t.Error(workerError)
+	}
+}
+
+func TestModuleProcessorOrder(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.RequiredModuleDataFields = []string{"color"}
+	conf.RedactedModuleDataFields = []string{"color"}
+	tasks := []model.CamundaExternalTask{{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+		"info.color":       {Value: `"red"`},
+		"info.module_data": {Value: `{"foo":"a"}`},
+	}}}
+
+	//the additional module data fields are set before the processors run
+	results, ok := pkg.Render(conf, libConf, tasks, nil)
+	if !ok || len(results) != 1 || len(results[0].Modules) != 1 || !reflect.DeepEqual(results[0].Modules[0].ModuleData, map[string]interface{}{"foo": "a"}) {
+		t.Errorf("%#v", results)
+	}
+
+	conf.ModuleProcessors = []string{pkg.ModuleProcessorRedaction, pkg.ModuleProcessorValidation}
+	results, ok = pkg.Render(conf, libConf, tasks, nil)
+	if ok || len(results) != 1 || results[0].Error != "missing required module_data field color" {
+		t.Errorf("%#v", results)
+	}
+
+	conf.ModuleProcessors = []string{pkg.ModuleProcessorValidation, "encryption"}
+	err = conf.Validate()
+	if err == nil || !strings.Contains(err.Error(), "unknown module processor: encryption") {
+		t.Error(err)
+	}
+	conf.ModuleProcessors = []string{pkg.ModuleProcessorValidation, "additional_module_data_fields", pkg.ModuleProcessorRedaction}
+	err = conf.Validate()
+	if err == nil || !strings.Contains(err.Error(), "unknown module processor: additional_module_data_fields") {
+		t.Error(err)
+	}
+}
+
+// additional module data fields are set for single modules before their migration, but not for the entries of modules
+func TestModuleAdditionalFieldsMigration(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_type":    {Value: "migration-test-widget"},
+			"info.module_version": {Value: "1"},
+			"info.title":          {Value: `"red"`},
+			"info.module_data":    {Value: `{"foo":"a"}`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.title":   {Value: `"red"`},
+			"info.modules": {Value: `[{"module_data":{"foo":"b"}}]`},
+		}},
+	}
+	results, ok := pkg.Render(conf, libConf, tasks, nil)
+	if !ok || len(results) != 2 || len(results[0].Modules) != 1 || len(results[1].Modules) != 1 {
+		t.Errorf("%#v", results)
+		return
+	}
+	data := results[0].Modules[0].ModuleData
+	if _, ok := data["title"]; ok || !reflect.DeepEqual(data["header"], map[string]interface{}{"text": "red"}) {
+		t.Errorf("%#v", data)
+	}
+	if _, ok := results[1].Modules[0].ModuleData["title"]; ok {
+		t.Errorf("%#v", results[1].Modules[0].ModuleData)
+	}
+}
+
+func TestModuleRedaction(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.RedactedModuleDataFields = []string{"password", "credentials.token", "series.token", "missing.field"}
+	tasks := []model.CamundaExternalTask{{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+		"info.password":    {Value: `"secret"`},
+		"info.module_data": {Value: `{"credentials":{"user":"u","token":"t"},"series":[{"name":"a","token":"t1"},{"name":"b"}],"missing":"x"}`},
+	}}}
+
+	results, ok := pkg.Render(conf, libConf, tasks, nil)
+	if !ok || len(results) != 1 || len(results[0].Modules) != 1 {
+		t.Errorf("%#v", results)
+		return
+	}
+	expected := map[string]interface{}{
+		"credentials": map[string]interface{}{"user": "u"},
+		"series":      []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+		"missing":     "x",
+	}
+	if !reflect.DeepEqual(results[0].Modules[0].ModuleData, expected) {
+		t.Errorf("\n%#v\n%#v", results[0].Modules[0].ModuleData, expected)
+	}
+
+	conf.ModuleProcessors = []string{pkg.ModuleProcessorValidation}
+	err = conf.Validate()
+	if err == nil || !strings.Contains(err.Error(), "redacted_module_data_fields requires the redaction module processor") {
+		t.Error(err)
+	}
+
+	conf.ModuleProcessors = nil
+	conf.RedactedModuleDataFields = []string{"credentials..token"}
+	err = conf.Validate()
+	if err == nil || !strings.Contains(err.Error(), "empty path segment") {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestProfiles(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.Profiles = []pkg.Profile{
+		{
+			CamundaWorkerTopic:               "info",
+			WorkerParamPrefix:                "info.",
+			EnableAdditionalModuleDataFields: true,
+		},
+		{
+			CamundaWorkerTopic:       "widget",
+			WorkerParamPrefix:        "widget.",
+			AllowedModuleTypes:       []string{"widget", "chart"},
+			RequiredModuleDataFields: []string{"title"},
+			RequireKey:               true,
+		},
+	}
+	err = conf.Validate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	camunda.AddToTopicQueue("info", []model.CamundaExternalTask{{
+		Id:                "task1",
+		ProcessInstanceId: "process-instance-1",
+		Variables: map[string]model.CamundaVariable{
+			"info.module_data": {Value: `{"foo":"bar"}`},
+			"info.color":       {Value: `"red"`},
+		},
+	}})
+	camunda.AddToTopicQueue("widget", []model.CamundaExternalTask{
+		{
+			Id:                "task2",
+			ProcessInstanceId: "process-instance-2",
+			Variables: map[string]model.CamundaVariable{
+				"widget.key":         {Value: "42"},
+				"widget.module_type": {Value: "chart"},
+				"widget.module_data": {Value: `{"title":"Temperature"}`},
+				"widget.color":       {Value: `"red"`},
+				"info.module_data":   {Value: `{"foo":"bar"}`},
+			},
+		},
+		{
+			Id:                "task3",
+			ProcessInstanceId: "process-instance-3",
+			Variables: map[string]model.CamundaVariable{
+				"widget.module_data": {Value: `{"title":"Temperature"}`},
+			},
+		},
+		{
+			Id:                "task4",
+			ProcessInstanceId: "process-instance-4",
+			Variables: map[string]model.CamundaVariable{
+				"widget.key":         {Value: "42"},
+				"widget.module_data": {Value: `{"foo":"bar"}`},
+			},
+		},
+		{
+			Id:                "task5",
+			ProcessInstanceId: "process-instance-5",
+			Variables: map[string]model.CamundaVariable{
+				"widget.key":         {Value: "42"},
+				"widget.module_type": {Value: "info"},
+				"widget.module_data": {Value: `{"title":"Temperature"}`},
+			},
+		},
+	})
+
+	time.Sleep(2 * time.Second)
+
+	modules := smartServiceRepo.GetModules()
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Id < modules[j].Id
+	})
+	if len(modules) != 2 {
+		t.Errorf("%#v", modules)
+		return
+	}
+	if modules[0].Id != "process-instance-1.task1" || modules[0].ModuleType != "info" || !reflect.DeepEqual(modules[0].ModuleData, map[string]interface{}{"foo": "bar", "color": "red"}) {
+		t.Errorf("%#v", modules[0])
+	}
+	if modules[1].Id != "process-instance-2.task2" || modules[1].ModuleType != "chart" || !reflect.DeepEqual(modules[1].Keys, []string{"42"}) || !reflect.DeepEqual(modules[1].ModuleData, map[string]interface{}{"title": "Temperature"}) {
+		t.Errorf("%#v", modules[1])
+	}
+
+	workerErrors := map[string]string{}
+	for _, request := range smartServiceRepo.GetRequestLog() {
+		if strings.HasPrefix(request.Endpoint, "/instances-by-process-id/") && strings.HasSuffix(request.Endpoint, "/error") {
+			msg := ""
+			err = json.Unmarshal([]byte(request.Message), &msg)
+			if err != nil {
+				t.Error(err)
+			}
+			workerErrors[strings.Split(request.Endpoint, "/")[2]] = msg
+		}
+	}
+	expectedErrors := map[string]string{
+		"process-instance-3": "widget: missing required key",
+		"process-instance-4": "widget: missing required module_data field title",
+		"process-instance-5": "widget: module type info is not allowed for widget",
+	}
+	if !reflect.DeepEqual(workerErrors, expectedErrors) {
+		t.Errorf("\n%#v\n%#v", workerErrors, expectedErrors)
+	}
+}
+
+func TestProfileValidation(t *testing.T) {
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.Profiles = []pkg.Profile{
+		{CamundaWorkerTopic: "info", WorkerParamPrefix: "info."},
+		{CamundaWorkerTopic: "info", WorkerParamPrefix: "widget."},
+		{WorkerParamPrefix: "notification."},
+	}
+	err = conf.Validate()
+	expected := "profiles[1]: duplicate camunda_worker_topic info\nprofiles[2]: missing camunda_worker_topic"
+	if err == nil || err.Error() != expected {
+		t.Error(err)
+	}
+}
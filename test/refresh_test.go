@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestModuleRefreshTrigger(t *testing.T) {
+	address, err := getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiAddress, err := getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	smartServiceRepo, stop := startRefreshTest(t, func(conf *pkg.Config) {
+		conf.ApiAddress = apiAddress
+		conf.AdminApiAddress = address
+		conf.ShutdownDelay = ""
+	})
+	defer stop()
+	if smartServiceRepo == nil {
+		return
+	}
+	checkRefreshedCount(t, smartServiceRepo, 1)
+
+	smartServiceRepo.SetVariables(map[string]interface{}{"count": 2})
+
+	result := pkg.RefreshResult{}
+	err = postExpectStatus("http://"+address+"/refresh", http.StatusOK, &result)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result != (pkg.RefreshResult{Refreshed: 1}) {
+		t.Errorf("%#v", result)
+	}
+	checkRefreshedCount(t, smartServiceRepo, 2)
+
+	//the refresh is not served by the unauthenticated api of the probes
+	err = postExpectStatus("http://"+apiAddress+"/refresh", http.StatusNotFound, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	requestCount := len(smartServiceRepo.GetRequestLog())
+	result = pkg.RefreshResult{}
+	err = postExpectStatus("http://"+address+"/refresh/process-instance-1.task1", http.StatusOK, &result)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result != (pkg.RefreshResult{Unchanged: 1}) {
+		t.Errorf("%#v", result)
+	}
+	//a single module is searched only in the module types of the worker and its process instance is confirmed with the repository
+	for _, request := range smartServiceRepo.GetRequestLog()[requestCount:] {
+		if strings.HasPrefix(request.Endpoint, "/modules?") && request.Endpoint != "/modules?limit=100&module_type=info" {
+			t.Errorf("%#v", request)
+		}
+		if strings.Contains(request.Endpoint, "/modules?") && !strings.HasPrefix(request.Endpoint, "/modules?") && request.Endpoint != "/instances-by-process-id/process-instance-1/modules?module_type=info" {
+			t.Errorf("%#v", request)
+		}
+	}
+
+	err = postExpectStatus("http://"+address+"/refresh/unknown", http.StatusNotFound, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	err = postExpectStatus("http://"+address+"/refresh/process-instance-1.unknown", http.StatusNotFound, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	//the process instance in the metadata of the module is not trusted without the confirmation of the repository
+	smartServiceRepo.SetProcessInstanceModules(map[string][]string{"process-instance-2": {"process-instance-1.task1"}})
+	smartServiceRepo.SetVariables(map[string]interface{}{"count": 3})
+	err = postExpectStatus("http://"+address+"/refresh/process-instance-1.task1", http.StatusNotFound, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	result = pkg.RefreshResult{}
+	err = postExpectStatus("http://"+address+"/refresh", http.StatusOK, &result)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result != (pkg.RefreshResult{Failed: 1}) {
+		t.Errorf("%#v", result)
+	}
+	checkRefreshedCount(t, smartServiceRepo, 2)
+}
+
+func TestModuleRefreshSchedule(t *testing.T) {
+	smartServiceRepo, stop := startRefreshTest(t, func(conf *pkg.Config) {
+		conf.ModuleRefreshInterval = "100ms"
+	})
+	defer stop()
+	if smartServiceRepo == nil {
+		return
+	}
+	checkRefreshedCount(t, smartServiceRepo, 1)
+	smartServiceRepo.SetVariables(map[string]interface{}{"count": 3})
+	time.Sleep(500 * time.Millisecond)
+	checkRefreshedCount(t, smartServiceRepo, 3)
+}
+
+// the template of a refreshable module may not be recorded in siblings, that are moved by its position
+func TestModuleRefreshPositionCollision(t *testing.T) {
+	address, err := getFreeAddress()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	smartServiceRepo, stop := startRefreshTestWithTasks(t, func(conf *pkg.Config) {
+		conf.AdminApiAddress = address
+		conf.ShutdownDelay = ""
+	}, []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "a"},
+			"info.position":    {Value: "0"},
+			"info.module_data": {Value: `{"name": "a"}`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "b"},
+			"info.position":    {Value: "0"},
+			"info.refresh":     {Value: "true"},
+			"info.module_data": {Value: `{"count": {{.count}}}`},
+		}},
+	})
+	defer stop()
+	if smartServiceRepo == nil {
+		return
+	}
+	smartServiceRepo.SetVariables(map[string]interface{}{"count": 2})
+	result := pkg.RefreshResult{}
+	err = postExpectStatus("http://"+address+"/refresh", http.StatusOK, &result)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result != (pkg.RefreshResult{Refreshed: 1}) {
+		t.Errorf("%#v", result)
+	}
+
+	modules := map[string]model.SmartServiceModule{}
+	for _, module := range smartServiceRepo.GetModules() {
+		modules[module.Keys[0]] = module
+	}
+	if len(modules) != 2 {
+		t.Errorf("%#v", modules)
+		return
+	}
+	meta, _ := modules["a"].ModuleData["_meta"].(map[string]interface{})
+	if modules["a"].ModuleData["name"] != "a" || modules["a"].ModuleData["count"] != nil || meta["template"] != nil || meta["position"] != 1.0 {
+		t.Errorf("%#v", modules["a"].ModuleData)
+	}
+	meta, _ = modules["b"].ModuleData["_meta"].(map[string]interface{})
+	if modules["b"].ModuleData["count"] != 2.0 || meta["template"] == nil || meta["position"] != 0.0 {
+		t.Errorf("%#v", modules["b"].ModuleData)
+	}
+}
+
+// runs a task with a refreshable module, rendered with count=1
+func startRefreshTest(t *testing.T, configure func(conf *pkg.Config)) (smartServiceRepo *mocks.SmartServiceRepoMock, stop func()) {
+	return startRefreshTestWithTasks(t, configure, []model.CamundaExternalTask{{
+		Id:                "task1",
+		ProcessInstanceId: "process-instance-1",
+		Variables: map[string]model.CamundaVariable{
+			"info.refresh":     {Value: "true"},
+			"info.module_data": {Value: `{"count": {{.count}}}`},
+		},
+	}})
+}
+
+func startRefreshTestWithTasks(t *testing.T, configure func(conf *pkg.Config), tasks []model.CamundaExternalTask) (smartServiceRepo *mocks.SmartServiceRepoMock, stop func()) {
+	wg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	stop = func() {
+		cancel()
+		wg.Wait()
+	}
+
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return nil, stop
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return nil, stop
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	configure(&conf)
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	camunda.AddToQueue(tasks)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo = mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	smartServiceRepo.SetVariables(map[string]interface{}{"count": 1})
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return nil, stop
+	}
+	time.Sleep(1 * time.Second)
+	return smartServiceRepo, stop
+}
+
+func checkRefreshedCount(t *testing.T, smartServiceRepo *mocks.SmartServiceRepoMock, expected float64) {
+	t.Helper()
+	modules := smartServiceRepo.GetModules()
+	if len(modules) != 1 {
+		t.Errorf("%#v", modules)
+		return
+	}
+	if modules[0].ModuleData["count"] != expected {
+		t.Errorf("%#v", modules[0].ModuleData)
+	}
+	meta, ok := modules[0].ModuleData["_meta"].(map[string]interface{})
+	if !ok || meta["template"] == nil || meta["process_instance_id"] != "process-instance-1" {
+		t.Errorf("%#v", modules[0].ModuleData)
+	}
+}
+
+func postExpectStatus(url string, expectedCode int, result interface{}) error {
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != expectedCode {
+		return fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+func getFreeAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	return listener.Addr().String(), nil
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestReload(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	configLocation := filepath.Join(t.TempDir(), "config.json")
+	err = writeConfigFile(configLocation, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	reloader := pkg.NewReloader(configLocation)
+	err = pkg.Start(ctx, wg, conf, libConf, pkg.WithReloader(reloader))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	handleTask := func(taskId string, variables map[string]model.CamundaVariable) {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                taskId,
+			ProcessInstanceId: "process-instance-1",
+			Variables:         variables,
+		}})
+		time.Sleep(500 * time.Millisecond)
+	}
+	getModuleData := func(taskId string) map[string]interface{} {
+		for _, module := range smartServiceRepo.GetModules() {
+			if module.Id == "process-instance-1."+taskId {
+				return module.ModuleData
+			}
+		}
+		return nil
+	}
+
+	handleTask("task1", map[string]model.CamundaVariable{
+		"info.module_data": {Value: `{"foo":"bar"}`},
+		"info.color":       {Value: `"red"`},
+	})
+	if moduleData := getModuleData("task1"); !reflect.DeepEqual(moduleData, map[string]interface{}{"foo": "bar", "color": "red"}) {
+		t.Errorf("%#v", moduleData)
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		reloaded := conf
+		reloaded.WorkerParamPrefix = "widget."
+		reloaded.EnableAdditionalModuleDataFields = false
+		reloaded.RequiredModuleDataFields = []string{"foo"}
+		reloaded.ExpiredModuleAction = pkg.ExpiredModuleActionMark
+		err = writeConfigFile(configLocation, reloaded, libConf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		changes, err := reloader.Reload()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].Name < changes[j].Name
+		})
+		expected := []pkg.ConfigChange{
+			{Name: "enable_additional_module_data_fields", Old: true, New: false, Applied: true},
+			{Name: "expired_module_action", Old: pkg.ExpiredModuleActionDelete, New: pkg.ExpiredModuleActionMark, Applied: false},
+			{Name: "required_module_data_fields", Old: []string{}, New: []string{"foo"}, Applied: true},
+			{Name: "worker_param_prefix", Old: "info.", New: "widget.", Applied: true},
+		}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("\n%#v\n%#v", changes, expected)
+		}
+
+		handleTask("task2", map[string]model.CamundaVariable{
+			"widget.module_data": {Value: `{"foo":"bar"}`},
+			"widget.color":       {Value: `"red"`},
+		})
+		if moduleData := getModuleData("task2"); !reflect.DeepEqual(moduleData, map[string]interface{}{"foo": "bar"}) {
+			t.Errorf("%#v", moduleData)
+		}
+		handleTask("task3", map[string]model.CamundaVariable{
+			"widget.module_data": {Value: `{"bar":"foo"}`},
+		})
+		if moduleData := getModuleData("task3"); moduleData != nil {
+			t.Errorf("expected rejected module %#v", moduleData)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		reloaded := conf
+		reloaded.WorkerParamPrefix = "notification."
+		reloaded.ExpiredModuleAction = "archive"
+		err = writeConfigFile(configLocation, reloaded, libConf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = reloader.Reload()
+		if err == nil {
+			t.Error("expected error")
+		}
+
+		reloaded.ExpiredModuleAction = pkg.ExpiredModuleActionDelete
+		reloaded.Profiles = []pkg.Profile{{CamundaWorkerTopic: "notification", WorkerParamPrefix: "notification."}}
+		err = writeConfigFile(configLocation, reloaded, libConf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = reloader.Reload()
+		if err == nil {
+			t.Error("expected error")
+		}
+
+		handleTask("task4", map[string]model.CamundaVariable{
+			"widget.module_data": {Value: `{"foo":"baz"}`},
+		})
+		if moduleData := getModuleData("task4"); !reflect.DeepEqual(moduleData, map[string]interface{}{"foo": "baz"}) {
+			t.Errorf("%#v", moduleData)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		reloader.Watch(ctx, wg, 100*time.Millisecond)
+		err = writeConfigFile(configLocation, conf, libConf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+
+		handleTask("task5", map[string]model.CamundaVariable{
+			"info.module_data": {Value: `{"foo":"bar"}`},
+			"info.color":       {Value: `"red"`},
+		})
+		if moduleData := getModuleData("task5"); !reflect.DeepEqual(moduleData, map[string]interface{}{"foo": "bar", "color": "red"}) {
+			t.Errorf("%#v", moduleData)
+		}
+	})
+
+	t.Run("watch templates", func(t *testing.T) {
+		templatesDir := t.TempDir()
+		templateLocation := filepath.Join(templatesDir, "chart@1.json")
+		err = os.WriteFile(templateLocation, []byte(`{"type":"chart","color":"green"}`), 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		templatesConf := conf
+		templatesConf.ModuleDataTemplatesDir = templatesDir
+		err = writeConfigFile(configLocation, templatesConf, libConf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+
+		handleTask("task6", map[string]model.CamundaVariable{"info.module_data_ref": {Value: "chart@1"}})
+		if moduleData := getModuleData("task6"); !reflect.DeepEqual(moduleData, map[string]interface{}{"type": "chart", "color": "green"}) {
+			t.Errorf("%#v", moduleData)
+		}
+
+		//versioned templates are cached until the next reload, which is triggered by the changed template file
+		err = os.WriteFile(templateLocation, []byte(`{"type":"chart","color":"blue"}`), 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+
+		handleTask("task7", map[string]model.CamundaVariable{"info.module_data_ref": {Value: "chart@1"}})
+		if moduleData := getModuleData("task7"); !reflect.DeepEqual(moduleData, map[string]interface{}{"type": "chart", "color": "blue"}) {
+			t.Errorf("%#v", moduleData)
+		}
+	})
+}
+
+// writes the fields of config and libConfig to one config file
+func writeConfigFile(location string, config pkg.Config, libConfig configuration.Config) error {
+	fields := map[string]interface{}{}
+	for _, value := range []interface{}{libConfig, config} {
+		temp, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(temp, &fields)
+		if err != nil {
+			return err
+		}
+	}
+	content, err := json.MarshalIndent(fields, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(location, content, 0644)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestRender(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	existing := []model.SmartServiceModule{{
+		SmartServiceModuleBase: model.SmartServiceModuleBase{Id: "process-instance-0.task1"},
+		SmartServiceModuleInit: model.SmartServiceModuleInit{
+			ModuleType: "info",
+			ModuleData: map[string]interface{}{"foo": "old"},
+			Keys:       []string{"42"},
+		},
+	}}
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.module_data": {Value: `{"foo":"new"}`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_data": {Value: `{"bar":`},
+		}},
+		{Id: "task3", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.mode":        {Value: "update_only"},
+			"info.module_data": {Value: `{"foo":"newer"}`},
+		}},
+		{Id: "task4", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":  {Value: "42"},
+			"info.mode": {Value: "delete"},
+		}},
+		{Id: "task5", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.mode":        {Value: "update_only"},
+			"info.module_data": {Value: `{"foo":"newest"}`},
+		}},
+	}
+
+	results, ok := pkg.Render(conf, libConf, tasks, existing)
+	if ok {
+		t.Error("expected failed task")
+	}
+	expected := []pkg.RenderResult{
+		{TaskId: "task1", Modules: []pkg.RenderedModule{{Id: "process-instance-0.task1", SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"foo": "new"}, Keys: []string{"42"}}}}},
+		{TaskId: "task2", Modules: []pkg.RenderedModule{}, Error: "invalid json for module_data: unexpected end of JSON input, ({\"bar\":)"},
+		{TaskId: "task3", Modules: []pkg.RenderedModule{{Id: "process-instance-0.task1", SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"foo": "newer"}, Keys: []string{"42"}}}}},
+		{TaskId: "task4", Modules: []pkg.RenderedModule{}, DeletedModules: []string{"process-instance-0.task1"}},
+		{TaskId: "task5", Modules: []pkg.RenderedModule{}, Error: results[4].Error},
+	}
+	if results[4].Error == "" {
+		t.Error("expected update_only error for deleted module")
+	}
+	actualJson, _ := json.Marshal(results)
+	expectedJson, _ := json.Marshal(expected)
+	var actualNormalized, expectedNormalized interface{}
+	_ = json.Unmarshal(actualJson, &actualNormalized)
+	_ = json.Unmarshal(expectedJson, &expectedNormalized)
+	if !reflect.DeepEqual(actualNormalized, expectedNormalized) {
+		t.Errorf("\n%v\n%v", string(actualJson), string(expectedJson))
+	}
+}
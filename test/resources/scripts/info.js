@@ -0,0 +1,8 @@
+function transform(data, variables, existing) {
+    data.total = data.values.reduce(function (sum, value) { return sum + value; }, 0);
+    data.color = data.total > 10 ? "red" : "green";
+    data.previous_total = existing ? existing.total : null;
+    data.title = variables["info.title"];
+    data._meta = "ignored";
+    return data;
+}
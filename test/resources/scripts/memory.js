@@ -0,0 +1,6 @@
+function transform(data) {
+    var list = [];
+    while (true) {
+        list.push(new Array(1000).fill("x"));
+    }
+}
@@ -0,0 +1,3 @@
+function transform(data) {
+    return 42;
+}
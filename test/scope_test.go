@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// the module of the user is found, even if it is not on the first page of the modules with the key
+func TestUserScopePagination(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	modules := []model.SmartServiceModule{}
+	for i := 0; i < 150; i++ {
+		modules = append(modules, model.SmartServiceModule{
+			SmartServiceModuleBase: model.SmartServiceModuleBase{Id: fmt.Sprintf("process-instance-other-user.task%v", i), UserId: "other-user"},
+			SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"batz": "other"}, Keys: []string{"42"}},
+		})
+	}
+	modules = append(modules, model.SmartServiceModule{
+		SmartServiceModuleBase: model.SmartServiceModuleBase{Id: "process-instance-0.task1", UserId: "ebbad927-4c39-4d12-8690-89b067dd4ce7"},
+		SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"batz": "42"}, Keys: []string{"42"}},
+	})
+	moduleList, err := json.Marshal(modules)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	camunda.AddToQueue([]model.CamundaExternalTask{{
+		Id:                "task1",
+		ProcessInstanceId: "process-instance-1",
+		Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.key_scope":   {Value: "user"},
+			"info.module_data": {Value: `{"foo":"bar"}`},
+		},
+	}})
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, moduleList)
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(time.Second)
+
+	result := smartServiceRepo.GetModules()
+	if len(result) != len(modules) {
+		t.Error(len(result))
+		return
+	}
+	if data := result[len(result)-1].ModuleData; data["foo"] != "bar" {
+		t.Errorf("%#v", data)
+	}
+}
+
+// user scoped modules of other instances of the user are not deleted through the current process instance
+func TestUserScopeDelete(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userId := "ebbad927-4c39-4d12-8690-89b067dd4ce7"
+	moduleList, err := json.Marshal([]model.SmartServiceModule{
+		{
+			SmartServiceModuleBase: model.SmartServiceModuleBase{Id: "process-instance-0.task1", UserId: userId},
+			SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"batz": "42"}, Keys: []string{"42"}},
+		},
+		{
+			SmartServiceModuleBase: model.SmartServiceModuleBase{Id: "process-instance-1.task0", UserId: userId},
+			SmartServiceModuleInit: model.SmartServiceModuleInit{ModuleType: "info", ModuleData: map[string]interface{}{"batz": "43"}, Keys: []string{"43"}},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	for _, key := range []string{"42", "43"} {
+		camunda.AddToQueue([]model.CamundaExternalTask{{
+			Id:                "task" + key,
+			ProcessInstanceId: "process-instance-1",
+			Variables: map[string]model.CamundaVariable{
+				"info.key":       {Value: key},
+				"info.key_scope": {Value: "user"},
+				"info.mode":      {Value: "delete"},
+			},
+		}})
+	}
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, moduleList)
+	smartServiceRepo.SetProcessInstanceModules(map[string][]string{
+		"process-instance-0": {"process-instance-0.task1"},
+		"process-instance-1": {"process-instance-1.task0"},
+	})
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	err = pkg.Start(ctx, wg, conf, libConf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(time.Second)
+
+	result := smartServiceRepo.GetModules()
+	if len(result) != 1 || result[0].Id != "process-instance-0.task1" {
+		t.Errorf("%#v", result)
+	}
+	taskFailed := false
+	for _, request := range smartServiceRepo.PopRequestLog() {
+		if request.Method == "DELETE" && request.Endpoint != "/instances-by-process-id/process-instance-1/modules/process-instance-1.task0" {
+			t.Errorf("unexpected delete: %#v", request)
+		}
+		if request.Method == "PUT" && request.Endpoint == "/instances-by-process-id/process-instance-1/error" {
+			taskFailed = true
+		}
+	}
+	if !taskFailed {
+		t.Error("expected error of the task deleting the module of the other instance")
+	}
+}
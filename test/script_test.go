@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestModuleScripts(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.ModuleScriptsDir = "resources/scripts"
+	conf.ModuleScriptTimeout = "500ms"
+	conf.ModuleScriptProcessAllocLimitMb = 16
+	err = conf.Validate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.title":       {Value: "first"},
+			"info.module_data": {Value: `{"values":[4,5]}`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.title":       {Value: "second"},
+			"info.module_data": {Value: `{"values":[6,7]}`},
+		}},
+		{Id: "task3", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_type": {Value: "loop"},
+		}},
+		{Id: "task4", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_type": {Value: "memory"},
+		}},
+		{Id: "task5", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_type": {Value: "number"},
+		}},
+		{Id: "task6", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_type": {Value: "widget"},
+			"info.module_data": {Value: `{"values":[1]}`},
+		}},
+	}
+	results, _ := pkg.Render(conf, libConf, tasks, nil)
+	if len(results) != len(tasks) {
+		t.Errorf("%#v", results)
+		return
+	}
+
+	expectedData := []map[string]interface{}{
+		{"values": []interface{}{4.0, 5.0}, "total": 9.0, "color": "green", "previous_total": nil, "title": "first"},
+		{"values": []interface{}{6.0, 7.0}, "total": 13.0, "color": "red", "previous_total": 9.0, "title": "second"},
+	}
+	for i, expected := range expectedData {
+		if results[i].Error != "" || len(results[i].Modules) != 1 || !reflect.DeepEqual(results[i].Modules[0].ModuleData, expected) {
+			t.Errorf("\n%#v\n%#v", results[i], expected)
+		}
+	}
+	for i, expected := range []string{"module script loop: module script timeout", "module script memory: process allocations exceeded module_script_process_alloc_limit_mb while the module script ran", "module script number: transform must return an object"} {
+		if !strings.HasPrefix(results[i+2].Error, expected) {
+			t.Errorf("\n%#v\n%#v", results[i+2].Error, expected)
+		}
+	}
+	if results[5].Error != "" || len(results[5].Modules) != 1 || !reflect.DeepEqual(results[5].Modules[0].ModuleData, map[string]interface{}{"values": []interface{}{1.0}}) {
+		t.Errorf("%#v", results[5])
+	}
+}
+
+func TestInvalidModuleScript(t *testing.T) {
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.ModuleScriptsDir = t.TempDir()
+	err = os.WriteFile(filepath.Join(conf.ModuleScriptsDir, "info.js"), []byte(`function transform(data) {`), 0644)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = conf.Validate()
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid module_scripts_dir: invalid module script") {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestSplitModuleData(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rows := []string{}
+	for i := 0; i < 300; i++ {
+		rows = append(rows, `{"label": "Zähler `+strconv.Itoa(i)+` – {{.name}}", "value": `+strconv.Itoa(i*7)+`, "unit": "m³"}`)
+	}
+	moduleData := `{"title": "Übersicht", "rows": [` + strings.Join(rows, ", ") + `]}`
+
+	for _, maxLength := range []int{25, 100, 4000, len(moduleData)} {
+		t.Run(strconv.Itoa(maxLength), func(t *testing.T) {
+			parts, err := pkg.SplitModuleData(conf.WorkerParamPrefix, moduleData, maxLength)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if maxLength == len(moduleData) && (len(parts) != 1 || parts[0].Name != "info.module_data") {
+				t.Errorf("%#v", parts)
+			}
+			names := []string{}
+			joined := ""
+			for _, part := range parts {
+				if len(part.Value) > maxLength {
+					t.Error("part too long", part.Name, len(part.Value))
+				}
+				if strings.Count(part.Value, "{{") != strings.Count(part.Value, "}}") {
+					t.Error("variable reference has been split", part.Name, part.Value)
+				}
+				names = append(names, part.Name)
+				joined = joined + part.Value
+			}
+			if !sort.StringsAreSorted(names) {
+				t.Error("names are not sorted in part order", names)
+			}
+			if joined != moduleData {
+				t.Error("joined parts differ from module_data")
+			}
+
+			variables := pkg.ModuleDataPartsToVariables(parts)
+			variables["info.key"] = model.CamundaVariable{Value: "split"}
+			results, ok := pkg.Render(conf, libConf, []model.CamundaExternalTask{{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: variables}}, nil)
+			if !ok || len(results) != 1 || len(results[0].Modules) != 1 {
+				t.Errorf("%#v", results)
+				return
+			}
+			expected := map[string]interface{}{}
+			err = json.Unmarshal([]byte(moduleData), &expected)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(results[0].Modules[0].ModuleData, expected) {
+				t.Error("rendered module_data differs from split module_data")
+			}
+		})
+	}
+
+	_, err = pkg.SplitModuleData(conf.WorkerParamPrefix, `{"foo": `, 10)
+	if err == nil {
+		t.Error("expected error for invalid json")
+	}
+	_, err = pkg.SplitModuleData(conf.WorkerParamPrefix, `{"foo": "{{.long_variable_name}}"}`, 10)
+	if err == nil {
+		t.Error("expected error for variable reference longer than max length")
+	}
+
+	xml, err := pkg.ModuleDataPartsToBpmn([]pkg.ModuleDataPart{{Name: "info.module_data_1", Value: `{"a": "<b>`}, {Name: "info.module_data_2", Value: `&"}`}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expectedXml := `<camunda:inputParameter name="info.module_data_1">{"a": "&lt;b&gt;</camunda:inputParameter>
+<camunda:inputParameter name="info.module_data_2">&amp;"}</camunda:inputParameter>
+`
+	if xml != expectedXml {
+		t.Error(xml)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestModuleDataTemplates(t *testing.T) {
+	mux := sync.Mutex{}
+	requests := map[string]int{}
+	store := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.Lock()
+		requests[request.URL.Path]++
+		mux.Unlock()
+		switch request.URL.Path {
+		case "/templates/gauge@2":
+			writer.Write([]byte(`{"type": "gauge", "max": 100}`))
+		case "/templates/chart":
+			writer.Write([]byte(`{"type": "remote chart"}`))
+		case "/templates/list":
+			writer.Write([]byte(`[]`))
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer store.Close()
+
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.EnableAdditionalModuleDataFields = true
+	conf.ModuleDataTemplatesDir = "resources/templates"
+	conf.ModuleDataTemplatesUrl = store.URL + "/templates/"
+	err = conf.Validate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":             {Value: "1"},
+			"info.module_data_ref": {Value: "chart"},
+			"info.module_data":     {Value: `{"title": "task title"}`},
+			"info.unit":            {Value: `"°C"`},
+		}},
+		{Id: "task2", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":             {Value: "2"},
+			"info.module_data_ref": {Value: "chart@1"},
+		}},
+		{Id: "task3", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.key":             {Value: "3"},
+			"info.module_data_ref": {Value: "gauge@2"},
+		}},
+		{Id: "task4", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.modules": {Value: `[{"key": "4", "module_data_ref": "gauge@2", "module_data": {"max": 50}}]`},
+		}},
+		{Id: "task5", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_data_ref": {Value: "gauge@3"},
+		}},
+		{Id: "task6", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_data_ref": {Value: "../chart"},
+		}},
+		{Id: "task7", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_data_ref": {Value: "list"},
+		}},
+	}
+	results, _ := pkg.Render(conf, libConf, tasks, nil)
+	if len(results) != len(tasks) {
+		t.Errorf("%#v", results)
+		return
+	}
+
+	expectedData := []map[string]interface{}{
+		{"type": "chart", "color": "blue", "title": "task title", "unit": "°C"},
+		{"type": "chart", "color": "red"},
+		{"type": "gauge", "max": 100.0},
+		{"type": "gauge", "max": 50.0},
+	}
+	for i, expected := range expectedData {
+		if results[i].Error != "" || len(results[i].Modules) != 1 || !reflect.DeepEqual(results[i].Modules[0].ModuleData, expected) {
+			t.Errorf("\n%#v\n%#v", results[i], expected)
+		}
+	}
+	for i, expected := range []string{"module_data_ref gauge@3: module data template not found", "invalid module_data_ref name", "module_data_ref list: template is no json object"} {
+		if !strings.HasPrefix(results[i+4].Error, expected) {
+			t.Errorf("\n%#v\n%#v", results[i+4].Error, expected)
+		}
+	}
+
+	// local templates are preferred; loaded templates are cached
+	expectedRequests := map[string]int{"/templates/gauge@2": 1, "/templates/gauge@3": 1, "/templates/list": 1}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("\n%#v\n%#v", requests, expectedRequests)
+	}
+}
+
+func TestModuleDataTemplatesNotConfigured(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf.ModuleDataTemplatesDir = ""
+	conf.ModuleDataTemplatesUrl = ""
+	tasks := []model.CamundaExternalTask{
+		{Id: "task1", ProcessInstanceId: "process-instance-1", Variables: map[string]model.CamundaVariable{
+			"info.module_data_ref": {Value: "chart"},
+		}},
+	}
+	results, ok := pkg.Render(conf, libConf, tasks, nil)
+	if ok || len(results) != 1 || results[0].Error != "module_data_ref chart: "+pkg.ErrModuleDataTemplatesNotConfigured.Error() {
+		t.Errorf("%#v", results)
+	}
+
+	conf.ModuleDataTemplatesDir = "resources/templates/chart.json"
+	conf.ModuleDataTemplatesUrl = "ftp://example.com"
+	err = conf.Validate()
+	if err == nil || !strings.Contains(err.Error(), "invalid module_data_templates_dir: not a directory") || !strings.Contains(err.Error(), "invalid module_data_templates_url: unsupported scheme") {
+		t.Error(err)
+	}
+}
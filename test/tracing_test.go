@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/pkg"
+	"github.com/SENERGY-Platform/smart-service-module-worker-info/test/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+	camunda.AddToQueue([]model.CamundaExternalTask{{
+		Id:                "task1",
+		ProcessInstanceId: "process-instance-1",
+		Variables: map[string]model.CamundaVariable{
+			"info.key":         {Value: "42"},
+			"info.module_type": {Value: "test-type"},
+			"info.module_data": {Value: `{"foo":"bar"}`},
+		},
+	}})
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	err = pkg.Start(ctx, wg, conf, libConf, pkg.WithTracerProvider(provider))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Second)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		if _, ok := spans[span.Name]; !ok {
+			spans[span.Name] = span
+		}
+	}
+
+	parents := map[string]string{
+		"Camunda.executeTask":                            "",
+		"smart_service_repository.get_instance_user":     "Camunda.executeTask",
+		"smart_service_repository.get_variables":         "Camunda.executeTask",
+		"Info.Do":                                        "Camunda.executeTask",
+		"Info.getExistingModule":                         "Info.Do",
+		"smart_service_repository.list_existing_modules": "Info.getExistingModule",
+		"Info.getModuleData":                             "Info.Do",
+		"Info.validateModuleData":                        "Info.getModuleData",
+		"smart_service_repository.send_modules":          "Camunda.executeTask",
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Error("missing span", name)
+			continue
+		}
+		if parent == "" {
+			if span.Parent.IsValid() {
+				t.Error("unexpected parent of", name)
+			}
+			continue
+		}
+		if span.Parent.SpanID() != spans[parent].SpanContext.SpanID() || span.SpanContext.TraceID() != spans[parent].SpanContext.TraceID() {
+			t.Error("unexpected parent of", name, "expected", parent)
+		}
+		if !hasAttribute(span.Attributes, attribute.String("process_instance_id", "process-instance-1")) {
+			t.Error("missing process_instance_id attribute", name, span.Attributes)
+		}
+	}
+
+	for _, expected := range []attribute.KeyValue{
+		attribute.String("process_instance_id", "process-instance-1"),
+		attribute.String("task_id", "task1"),
+		attribute.String("module_type", "test-type"),
+		attribute.String("key", "42"),
+	} {
+		if !hasAttribute(spans["Info.Do"].Attributes, expected) {
+			t.Error("missing Info.Do attribute", expected, spans["Info.Do"].Attributes)
+		}
+	}
+}
+
+// tasks of two profiles for the same process instance, handled at the same time, are traced separately
+func TestTracingProfiles(t *testing.T) {
+	libConf, err := configuration.LoadLibConfig("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf, err := configuration.Load[pkg.Config]("../config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	libConf.CamundaWorkerWaitDurationInMs = 200
+	conf.Profiles = []pkg.Profile{
+		{CamundaWorkerTopic: "info", WorkerParamPrefix: "info."},
+		{CamundaWorkerTopic: "widget", WorkerParamPrefix: "widget."},
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	camunda := mocks.NewCamundaMock()
+	libConf.CamundaUrl = camunda.Start(ctx, wg)
+
+	libConf.AuthEndpoint = mocks.Keycloak(ctx, wg)
+
+	smartServiceRepo := mocks.NewSmartServiceRepoMock(libConf, conf, []byte(`[]`))
+	smartServiceRepo.SetModuleListBarrier(2) //both tasks list their existing module at the same time
+	libConf.SmartServiceRepositoryUrl = smartServiceRepo.Start(ctx, wg)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	err = pkg.Start(ctx, wg, conf, libConf, pkg.WithTracerProvider(provider))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, topic := range []string{"info", "widget"} {
+		camunda.AddToTopicQueue(topic, []model.CamundaExternalTask{{
+			Id:                "task-" + topic,
+			ProcessInstanceId: "process-instance-1",
+			Variables: map[string]model.CamundaVariable{
+				topic + ".key":         {Value: "42"},
+				topic + ".module_data": {Value: `{"foo":"bar"}`},
+			},
+		}})
+	}
+
+	time.Sleep(2 * time.Second)
+
+	spans := map[trace.SpanID]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.SpanContext.SpanID()] = span
+	}
+	tasks := map[string]bool{}
+	for _, span := range spans {
+		if span.Name != "smart_service_repository.list_existing_modules" {
+			continue
+		}
+		//list_existing_modules -> Info.getExistingModule -> Info.Do -> Camunda.executeTask
+		root := span
+		for root.Parent.IsValid() {
+			parent, ok := spans[root.Parent.SpanID()]
+			if !ok {
+				t.Error("missing parent of", root.Name)
+				return
+			}
+			root = parent
+		}
+		if root.Name != "Camunda.executeTask" {
+			t.Error("unexpected root", root.Name)
+			continue
+		}
+		for _, attr := range root.Attributes {
+			if attr.Key == "task_id" {
+				tasks[attr.Value.AsString()] = true
+			}
+		}
+	}
+	if len(tasks) != 2 || !tasks["task-info"] || !tasks["task-widget"] {
+		t.Error("expected the module lists of both tasks in their own traces", tasks)
+	}
+}
+
+func hasAttribute(attributes []attribute.KeyValue, expected attribute.KeyValue) bool {
+	for _, actual := range attributes {
+		if actual == expected {
+			return true
+		}
+	}
+	return false
+}